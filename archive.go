@@ -0,0 +1,175 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ArchiveSource reads a tmframe archive partitioned by UTC day
+// under Dir, laid out as Dir/yyyy/mm/dd/*.tf, where each file
+// holds the time-sorted frames of its day. It yields, in
+// order, the frames in [From, To), merging the files within a
+// day. A day's files are opened only when reading reaches that
+// day, and days outside the range are never opened at all.
+// Entries whose names are not a valid year, month or day are
+// ignored.
+type ArchiveSource struct {
+	Dir  string
+	From time.Time
+	To   time.Time
+
+	days  []string // day directories not yet read, in order
+	cur   FrameSource
+	files []*os.File
+}
+
+// NewArchiveSource lists the day partitions under dir that
+// intersect [from, to). No frame files are opened yet.
+func NewArchiveSource(dir string, from, to time.Time) (*ArchiveSource, error) {
+	s := &ArchiveSource{Dir: dir, From: from, To: to}
+	years, err := partitions(dir, from, to, func(y int) (time.Time, bool) {
+		return time.Date(y, 1, 1, 0, 0, 0, 0, time.UTC), y >= 1 && y <= 9999
+	}, 1, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, y := range years {
+		months, err := partitions(y.path, from, to, func(m int) (time.Time, bool) {
+			return time.Date(y.n, time.Month(m), 1, 0, 0, 0, 0, time.UTC), m >= 1 && m <= 12
+		}, 0, 1, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range months {
+			days, err := partitions(m.path, from, to, func(d int) (time.Time, bool) {
+				t := time.Date(y.n, time.Month(m.n), d, 0, 0, 0, 0, time.UTC)
+				return t, d >= 1 && t.Day() == d
+			}, 0, 0, 1)
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range days {
+				s.days = append(s.days, d.path)
+			}
+		}
+	}
+	return s, nil
+}
+
+// NextFrame returns the next archived frame in [From, To),
+// or io.EOF once the range is exhausted.
+func (s *ArchiveSource) NextFrame() (*tf.Frame, error) {
+	for {
+		if s.cur == nil {
+			if len(s.days) == 0 {
+				return nil, io.EOF
+			}
+			if err := s.openDay(s.days[0]); err != nil {
+				return nil, err
+			}
+			s.days = s.days[1:]
+		}
+		f, err := s.cur.NextFrame()
+		if err == io.EOF {
+			if err := s.closeDay(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		t := time.Unix(0, f.Tm())
+		if t.Before(s.From) {
+			continue
+		}
+		if !t.Before(s.To) {
+			// later days can only hold later frames.
+			s.days = nil
+			if err := s.closeDay(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		return f, nil
+	}
+}
+
+// Close closes any files still open. Afterwards NextFrame
+// returns io.EOF.
+func (s *ArchiveSource) Close() error {
+	s.days = nil
+	return s.closeDay()
+}
+
+// openDay opens every *.tf file in the day directory and
+// merges them.
+func (s *ArchiveSource) openDay(day string) error {
+	paths, err := filepath.Glob(filepath.Join(day, "*.tf"))
+	if err != nil {
+		return err
+	}
+	srcs := make([]FrameSource, 0, len(paths))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			s.closeDay()
+			return err
+		}
+		s.files = append(s.files, f)
+		srcs = append(srcs, NewReaderSource(f))
+	}
+	s.cur = NewMerger(srcs...)
+	return nil
+}
+
+func (s *ArchiveSource) closeDay() error {
+	var first error
+	for _, f := range s.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.files = nil
+	s.cur = nil
+	return first
+}
+
+// partition is one numbered subdirectory of an archive level.
+type partition struct {
+	n    int
+	path string
+}
+
+// partitions returns, in numeric order, the subdirectories of
+// dir whose names are numbers n for which start(n) is valid
+// and whose span, start(n) plus years, months and days,
+// intersects [from, to).
+func partitions(dir string, from, to time.Time, start func(n int) (time.Time, bool), years, months, days int) ([]partition, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ps []partition
+	for _, e := range ents {
+		if !e.IsDir() {
+			continue
+		}
+		n, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		t, ok := start(n)
+		if !ok || !t.Before(to) || !t.AddDate(years, months, days).After(from) {
+			continue
+		}
+		ps = append(ps, partition{n, filepath.Join(dir, e.Name())})
+	}
+	sort.Slice(ps, func(i, j int) bool { return ps[i].n < ps[j].n })
+	return ps, nil
+}
@@ -0,0 +1,77 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeArchive writes frames to dir/yyyy/mm/dd/name, creating
+// the day directory as needed.
+func writeArchive(dir, name string, frames ...*tf.Frame) {
+	day := time.Unix(0, frames[0].Tm()).UTC().Format("2006/01/02")
+	panicOn(os.MkdirAll(filepath.Join(dir, day), 0755))
+	var by []byte
+	for _, f := range frames {
+		b, err := f.Marshal(nil)
+		panicOn(err)
+		by = append(by, b...)
+	}
+	panicOn(ioutil.WriteFile(filepath.Join(dir, day, name), by, 0644))
+}
+
+func Test054ArchiveSourceReadsOnlyTheRange(t *testing.T) {
+
+	cv.Convey("an ArchiveSource should merge the files of each day in range, in order, without opening days outside it", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-archive")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+
+		t0 := time.Date(2016, 2, 15, 0, 0, 0, 0, time.UTC)
+		at := func(h int) *tf.Frame {
+			f, err := tf.NewFrame(t0.Add(time.Duration(h)*time.Hour), tf.EvTwo64, 0, int64(h), nil)
+			panicOn(err)
+			return f
+		}
+		writeArchive(dir, "a.tf", at(1), at(5))
+		writeArchive(dir, "a.tf", at(24+2), at(24+6), at(24+20))
+		writeArchive(dir, "b.tf", at(24+3), at(24+6), at(24+21))
+		writeArchive(dir, "a.tf", at(48+1), at(48+9))
+		writeArchive(dir, "a.tf", at(72+1))
+
+		// days outside the range hold a *.tf that cannot be
+		// read, so opening one would surface as an error.
+		panicOn(os.MkdirAll(filepath.Join(dir, "2016/02/15/bad.tf"), 0755))
+		panicOn(os.MkdirAll(filepath.Join(dir, "2016/02/18/bad.tf"), 0755))
+		// names that are not dates are skipped.
+		panicOn(os.MkdirAll(filepath.Join(dir, "2016/02/31"), 0755))
+		panicOn(os.MkdirAll(filepath.Join(dir, "2016/tmp"), 0755))
+		panicOn(ioutil.WriteFile(filepath.Join(dir, "README"), nil, 0644))
+
+		s, err := NewArchiveSource(dir, t0.Add(24*time.Hour+3*time.Hour), t0.Add(48*time.Hour+9*time.Hour))
+		cv.So(err, cv.ShouldBeNil)
+
+		var got []int64
+		for f, err := range Frames(s) {
+			cv.So(err, cv.ShouldBeNil)
+			got = append(got, f.GetV1())
+		}
+		cv.So(got, cv.ShouldResemble, []int64{24 + 3, 24 + 6, 24 + 6, 24 + 20, 24 + 21, 48 + 1})
+		cv.So(s.files, cv.ShouldHaveLength, 0)
+		cv.So(s.Close(), cv.ShouldBeNil)
+
+		_, err = s.NextFrame()
+		cv.So(err, cv.ShouldEqual, io.EOF)
+	})
+
+	cv.Convey("an ArchiveSource over a missing directory should fail up front", t, func() {
+		_, err := NewArchiveSource(filepath.Join(os.TempDir(), "pq-no-such-archive"), time.Unix(0, 0), time.Now())
+		cv.So(err, cv.ShouldNotBeNil)
+	})
+}
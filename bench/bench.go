@@ -0,0 +1,162 @@
+// Package bench compares the pq queue and ring against naive
+// alternatives under a jittered-arrival workload, so users can
+// judge when the machinery is worth it.
+package bench
+
+import (
+	"github.com/glycerine/pq"
+	tf "github.com/glycerine/tmframe"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Workload describes a stream of N frames, one per Step, that
+// arrive shuffled by up to Jitter positions, as a UDP feed does.
+type Workload struct {
+	N      int
+	Jitter int
+	Step   time.Duration
+	Seed   int64
+}
+
+// Frames generates the workload's frames in arrival order.
+func (w Workload) Frames() []*tf.Frame {
+	t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+	step := w.Step
+	if step <= 0 {
+		step = time.Millisecond
+	}
+	frames := make([]*tf.Frame, w.N)
+	for i := range frames {
+		f, err := tf.NewFrame(t0.Add(time.Duration(i)*step), tf.EvTwo64, float64(i), int64(i), nil)
+		if err != nil {
+			panic(err)
+		}
+		frames[i] = f
+	}
+	if w.Jitter > 1 {
+		rng := rand.New(rand.NewSource(w.Seed))
+		for i := 0; i+w.Jitter <= len(frames); i += w.Jitter {
+			win := frames[i : i+w.Jitter]
+			rng.Shuffle(len(win), func(a, b int) { win[a], win[b] = win[b], win[a] })
+		}
+	}
+	return frames
+}
+
+// Sorter puts a slice of frames into timestamp order, returning a new slice.
+type Sorter func(in []*tf.Frame) []*tf.Frame
+
+// ViaPriorityQueue sorts by adding everything to a PriorityQueue and draining it.
+func ViaPriorityQueue(in []*tf.Frame) []*tf.Frame {
+	q := pq.NewPriorityQueue()
+	for _, f := range in {
+		q.Add(f)
+	}
+	out := make([]*tf.Frame, 0, len(in))
+	for f := range q.Drain() {
+		out = append(out, f)
+	}
+	return out
+}
+
+// ViaSortSlice is the naive baseline: copy and sort.Slice.
+func ViaSortSlice(in []*tf.Frame) []*tf.Frame {
+	out := append([]*tf.Frame(nil), in...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Tm() < out[j].Tm() })
+	return out
+}
+
+// ViaChannelAndSortSlice hands frames through a buffered
+// channel, as a goroutine pipeline would, then sorts with
+// sort.Slice: the usual hand-rolled alternative to pq.
+func ViaChannelAndSortSlice(in []*tf.Frame) []*tf.Frame {
+	ch := make(chan *tf.Frame, 1024)
+	go func() {
+		for _, f := range in {
+			ch <- f
+		}
+		close(ch)
+	}()
+	out := make([]*tf.Frame, 0, len(in))
+	for f := range ch {
+		out = append(out, f)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Tm() < out[j].Tm() })
+	return out
+}
+
+// ViaRingThenPriorityQueue absorbs arrivals in a FrameRingBuf,
+// moving them to a PriorityQueue in batches, the pattern used
+// for bursty network input.
+func ViaRingThenPriorityQueue(in []*tf.Frame) []*tf.Frame {
+	ring := pq.NewFrameRingBuf(256)
+	q := pq.NewPriorityQueue()
+	batch := make([]*tf.Frame, 256)
+	for len(in) > 0 {
+		n, _ := ring.RingWriteFrames(in)
+		in = in[n:]
+		k, _ := ring.RingReadFrames(batch)
+		for _, f := range batch[:k] {
+			q.Add(f)
+		}
+	}
+	out := make([]*tf.Frame, 0, q.Len())
+	for f := range q.Drain() {
+		out = append(out, f)
+	}
+	return out
+}
+
+// Sorters names the strategies compared by Run.
+var Sorters = []struct {
+	Name string
+	Sort Sorter
+}{
+	{"PriorityQueue", ViaPriorityQueue},
+	{"RingThenPriorityQueue", ViaRingThenPriorityQueue},
+	{"SortSlice", ViaSortSlice},
+	{"ChannelAndSortSlice", ViaChannelAndSortSlice},
+}
+
+// Result is the measurement of one strategy on one workload.
+type Result struct {
+	Name        string
+	NsPerFrame  float64
+	AllocsPerOp int64
+	Sorted      bool
+}
+
+// Run measures each of Sorters on w with testing.Benchmark.
+func Run(w Workload) []Result {
+	in := w.Frames()
+	var res []Result
+	for _, s := range Sorters {
+		sorter := s.Sort
+		br := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sorter(in)
+			}
+		})
+		res = append(res, Result{
+			Name:        s.Name,
+			NsPerFrame:  float64(br.NsPerOp()) / float64(len(in)),
+			AllocsPerOp: br.AllocsPerOp(),
+			Sorted:      IsSorted(sorter(in)),
+		})
+	}
+	return res
+}
+
+// IsSorted reports whether frames are in non-decreasing timestamp order.
+func IsSorted(frames []*tf.Frame) bool {
+	for i := 1; i < len(frames); i++ {
+		if frames[i].Tm() < frames[i-1].Tm() {
+			return false
+		}
+	}
+	return true
+}
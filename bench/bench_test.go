@@ -0,0 +1,37 @@
+package bench
+
+import (
+	"fmt"
+	"testing"
+)
+
+var jittered = Workload{N: 10000, Jitter: 16, Seed: 1}
+
+func benchSorter(b *testing.B, s Sorter) {
+	in := jittered.Frames()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s(in)
+	}
+}
+
+func BenchmarkPriorityQueue(b *testing.B)         { benchSorter(b, ViaPriorityQueue) }
+func BenchmarkRingThenPriorityQueue(b *testing.B) { benchSorter(b, ViaRingThenPriorityQueue) }
+func BenchmarkSortSlice(b *testing.B)             { benchSorter(b, ViaSortSlice) }
+func BenchmarkChannelAndSortSlice(b *testing.B)   { benchSorter(b, ViaChannelAndSortSlice) }
+
+// Every strategy must agree on the output before its speed matters.
+func Example() {
+	in := Workload{N: 2000, Jitter: 8, Seed: 42}.Frames()
+	fmt.Println("input sorted:", IsSorted(in))
+	for _, s := range Sorters {
+		fmt.Printf("%s sorted: %v\n", s.Name, IsSorted(s.Sort(in)))
+	}
+	// Output:
+	// input sorted: false
+	// PriorityQueue sorted: true
+	// RingThenPriorityQueue sorted: true
+	// SortSlice sorted: true
+	// ChannelAndSortSlice sorted: true
+}
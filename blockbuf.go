@@ -0,0 +1,245 @@
+package pq
+
+import (
+	"errors"
+	tm "github.com/glycerine/tmframe"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRingClosed is returned by writes to a closed BlockingRingBuf.
+var ErrRingClosed = errors.New("pq: write to closed ring")
+
+// BlockingRingBuf is a RingBuf safe for use by multiple
+// goroutines, making it a bounded producer/consumer queue:
+// Read blocks until data is available and Write blocks until
+// there is room. Close wakes all waiters.
+type BlockingRingBuf[T any] struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	ring     *RingBuf[T]
+	closed   bool
+
+	wakeK      int
+	wakeD      time.Duration
+	readySince time.Time // when the ring last went from empty to non-empty
+	spin       time.Duration
+	seq        uint32 // bumped by every Write and Close; atomic
+	stats      BlockingStats
+}
+
+// BlockingStats counts what a BlockingRingBuf's readers have
+// done. AddedLatency is the total time Reads held back
+// available data while waiting for a wake-up batch to fill;
+// it is the price paid for fewer Wakeups. Spins counts the
+// Reads whose wait for data ended while spinning (see SetSpin),
+// without parking.
+type BlockingStats struct {
+	Reads        int64
+	Wakeups      int64
+	AddedLatency time.Duration
+	Spins        int64
+}
+
+// BlockingFrameRingBuf is a BlockingRingBuf of *tm.Frame.
+type BlockingFrameRingBuf = BlockingRingBuf[*tm.Frame]
+
+// NewBlockingRingBuf returns a BlockingRingBuf holding up to
+// maxSize elements. A maxSize below 1 is taken as 1, since a
+// zero-size ring would block every writer forever.
+func NewBlockingRingBuf[T any](maxSize int) *BlockingRingBuf[T] {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	b := &BlockingRingBuf[T]{
+		ring: NewRingBuf[T](maxSize),
+	}
+	b.notEmpty = sync.NewCond(&b.mu)
+	b.notFull = sync.NewCond(&b.mu)
+	return b
+}
+
+// NewBlockingFrameRingBuf returns a BlockingFrameRingBuf holding up to maxSize frames.
+func NewBlockingFrameRingBuf(maxSize int) *BlockingFrameRingBuf {
+	return NewBlockingRingBuf[*tm.Frame](maxSize)
+}
+
+// Read blocks until at least one element is available, then
+// reads up to len(p) elements into p. Once the ring is closed
+// and drained, Read returns io.EOF. See SetWakeBatch for
+// holding Reads back until a batch has built up, and SetSpin
+// for polling before blocking.
+func (b *BlockingRingBuf[T]) Read(p []T) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	held := false
+	spun := false
+	for {
+		if b.ring.Readable == 0 {
+			if b.closed {
+				return 0, io.EOF
+			}
+			if b.spin > 0 && !spun {
+				spun = true
+				seen := atomic.LoadUint32(&b.seq)
+				b.mu.Unlock()
+				hit := spinUntil(b.spin, func() bool { return atomic.LoadUint32(&b.seq) != seen })
+				b.mu.Lock()
+				if hit {
+					b.stats.Spins++
+				}
+				continue
+			}
+			b.wait(0)
+			continue
+		}
+		if b.closed || b.batchReady() {
+			break
+		}
+		left := time.Duration(0)
+		if b.wakeD > 0 {
+			left = b.wakeD - time.Since(b.readySince)
+			if left <= 0 {
+				break
+			}
+		}
+		held = true
+		b.wait(left)
+	}
+	b.stats.Reads++
+	if held {
+		b.stats.AddedLatency += time.Since(b.readySince)
+	}
+	n, err = b.ring.RingReadFrames(p)
+	if n > 0 {
+		b.notFull.Broadcast()
+	}
+	return
+}
+
+// wait blocks on notEmpty, for at most d if d > 0.
+// b.mu must be held.
+func (b *BlockingRingBuf[T]) wait(d time.Duration) {
+	if d > 0 {
+		t := time.AfterFunc(d, func() {
+			b.mu.Lock()
+			b.notEmpty.Broadcast()
+			b.mu.Unlock()
+		})
+		defer t.Stop()
+	}
+	b.notEmpty.Wait()
+	b.stats.Wakeups++
+}
+
+// batchReady reports whether a wake-up batch is complete. A
+// full ring always counts, since a k larger than the ring could
+// otherwise never be reached while the writer waits for room.
+// b.mu must be held.
+func (b *BlockingRingBuf[T]) batchReady() bool {
+	return b.wakeK <= 1 || b.ring.Readable >= intMin(b.wakeK, b.ring.N)
+}
+
+// SetWakeBatch coalesces reader wake-ups: a blocked Read
+// returns only once k elements are readable, or d has passed
+// since the ring became non-empty, or the ring is closed. At
+// high rates this trades up to d of added latency for far
+// fewer context switches; Stats reports both sides. A d <= 0
+// means no time limit, and k <= 1 turns batching off. A k larger
+// than the ring is taken as the ring's size.
+func (b *BlockingRingBuf[T]) SetWakeBatch(k int, d time.Duration) {
+	b.mu.Lock()
+	b.wakeK = k
+	b.wakeD = d
+	b.mu.Unlock()
+	b.notEmpty.Broadcast()
+}
+
+// SetSpin has a Read that finds the ring empty poll for up to d,
+// yielding the processor between polls, before it parks on the
+// condition variable. At low rates this saves the futex sleep
+// and wake-up on the data path, at the cost of a busy core for
+// up to d per Read; Stats counts the waits spinning ended. A
+// d <= 0, the default, parks at once. Spinning applies only to
+// an empty ring, not to SetWakeBatch's hold-back.
+func (b *BlockingRingBuf[T]) SetSpin(d time.Duration) {
+	b.mu.Lock()
+	b.spin = d
+	b.mu.Unlock()
+}
+
+// spinUntil polls done, yielding the processor between polls,
+// for up to d, and reports whether done became true.
+func spinUntil(d time.Duration, done func() bool) bool {
+	deadline := time.Now().Add(d)
+	for !done() {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		runtime.Gosched()
+	}
+	return true
+}
+
+// Stats returns a snapshot of the reader-side counters.
+func (b *BlockingRingBuf[T]) Stats() BlockingStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// Write blocks until all of p has been written, writing
+// in pieces as room frees up. If the ring is closed first,
+// Write returns the count written so far and ErrRingClosed.
+func (b *BlockingRingBuf[T]) Write(p []T) (n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(p) > 0 {
+		for b.ring.Readable == b.ring.N && !b.closed {
+			b.notFull.Wait()
+		}
+		if b.closed {
+			return n, ErrRingClosed
+		}
+		was := b.ring.Readable
+		k, _ := b.ring.RingWriteFrames(p)
+		atomic.AddUint32(&b.seq, 1)
+		n += k
+		p = p[k:]
+		if was == 0 {
+			b.readySince = time.Now()
+		}
+		// with batching on, readers need waking only to start
+		// their timers and once a full batch is ready.
+		if was == 0 || b.batchReady() {
+			b.notEmpty.Broadcast()
+		}
+	}
+	return n, nil
+}
+
+// Close marks the ring closed and wakes all blocked readers
+// and writers. Readers may still drain what remains.
+func (b *BlockingRingBuf[T]) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	atomic.AddUint32(&b.seq, 1)
+	b.mu.Unlock()
+	b.notEmpty.Broadcast()
+	b.notFull.Broadcast()
+	return nil
+}
+
+// Len returns the number of elements currently readable.
+func (b *BlockingRingBuf[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ring.Readable
+}
@@ -0,0 +1,169 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tm "github.com/glycerine/tmframe"
+	"io"
+	"testing"
+	"time"
+)
+
+func Test023BlockingRingBufIsABoundedChannel(t *testing.T) {
+
+	cv.Convey("a BlockingFrameRingBuf should carry every frame from producer to consumer in order, blocking on full and empty", t, func() {
+
+		n := 200
+		frames, _, _ := GenTestFrames(n, nil)
+		ring := NewBlockingFrameRingBuf(7)
+
+		go func() {
+			for i := 0; i < n; i += 5 {
+				end := i + 5
+				if end > n {
+					end = n
+				}
+				ring.Write(frames[i:end])
+			}
+			ring.Close()
+		}()
+
+		var got []*tm.Frame
+		buf := make([]*tm.Frame, 3)
+		for {
+			k, err := ring.Read(buf)
+			if err == io.EOF {
+				break
+			}
+			cv.So(err, cv.ShouldBeNil)
+			got = append(got, buf[:k]...)
+		}
+		cv.So(got, cv.ShouldResemble, frames)
+	})
+
+	cv.Convey("Close should release a writer blocked on a full ring", t, func() {
+
+		frames, _, _ := GenTestFrames(4, nil)
+		ring := NewBlockingFrameRingBuf(2)
+		done := make(chan error)
+		go func() {
+			_, err := ring.Write(frames)
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		cv.So(ring.Len(), cv.ShouldEqual, 2)
+		ring.Close()
+		cv.So(<-done, cv.ShouldEqual, ErrRingClosed)
+	})
+}
+
+func Test035BlockingRingBufWakeBatching(t *testing.T) {
+
+	cv.Convey("with SetWakeBatch a Read should wait for k elements, or give up after d and report the added latency", t, func() {
+
+		frames, _, _ := GenTestFrames(10, nil)
+		ring := NewBlockingFrameRingBuf(10)
+		ring.SetWakeBatch(4, 50*time.Millisecond)
+
+		buf := make([]*tm.Frame, 10)
+		got := make(chan int)
+		go func() {
+			k, _ := ring.Read(buf)
+			got <- k
+		}()
+		for i := 0; i < 4; i++ {
+			ring.Write(frames[i : i+1])
+		}
+		cv.So(<-got, cv.ShouldEqual, 4)
+
+		ring.Write(frames[4:6])
+		t0 := time.Now()
+		k, err := ring.Read(buf)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(k, cv.ShouldEqual, 2)
+		cv.So(time.Since(t0) >= 40*time.Millisecond, cv.ShouldBeTrue)
+
+		st := ring.Stats()
+		cv.So(st.Reads, cv.ShouldEqual, int64(2))
+		cv.So(st.AddedLatency >= 40*time.Millisecond, cv.ShouldBeTrue)
+		cv.So(st.Wakeups, cv.ShouldBeLessThanOrEqualTo, int64(4))
+	})
+}
+
+func Test052WakeBatchLargerThanTheRing(t *testing.T) {
+
+	cv.Convey("a wake batch bigger than the ring, with no time limit, should treat a full ring as ready rather than deadlock", t, func() {
+
+		frames, _, _ := GenTestFrames(20, nil)
+		ring := NewBlockingFrameRingBuf(4)
+		ring.SetWakeBatch(10, 0)
+
+		go func() {
+			ring.Write(frames)
+			ring.Close()
+		}()
+		var got []*tm.Frame
+		buf := make([]*tm.Frame, 10)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for {
+				k, err := ring.Read(buf)
+				if err == io.EOF {
+					return
+				}
+				got = append(got, buf[:k]...)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			panic("deadlock: reader and writer both stuck")
+		}
+		cv.So(got, cv.ShouldResemble, frames)
+	})
+}
+
+func Test060SpinThenPark(t *testing.T) {
+
+	cv.Convey("a Read with SetSpin should pick up data written while it spins, without parking, and park once the spin runs out", t, func() {
+
+		frames, _, _ := GenTestFrames(2, nil)
+		ring := NewBlockingFrameRingBuf(4)
+		ring.SetSpin(5 * time.Second)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			ring.Write(frames[:1])
+		}()
+		buf := make([]*tm.Frame, 2)
+		k, err := ring.Read(buf)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(k, cv.ShouldEqual, 1)
+		st := ring.Stats()
+		cv.So(st.Spins, cv.ShouldEqual, 1)
+		cv.So(st.Wakeups, cv.ShouldEqual, 0)
+
+		ring.SetSpin(time.Millisecond)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			ring.Write(frames[1:])
+		}()
+		k, err = ring.Read(buf)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(k, cv.ShouldEqual, 1)
+		st = ring.Stats()
+		cv.So(st.Spins, cv.ShouldEqual, 1)
+		cv.So(st.Wakeups, cv.ShouldBeGreaterThan, 0)
+
+		// a spinning reader sees Close too.
+		ring.SetSpin(5 * time.Second)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			ring.Close()
+		}()
+		t0 := time.Now()
+		_, err = ring.Read(buf)
+		cv.So(err, cv.ShouldEqual, io.EOF)
+		cv.So(time.Since(t0), cv.ShouldBeLessThan, time.Second)
+	})
+}
@@ -0,0 +1,133 @@
+package pq
+
+import (
+	"errors"
+	"fmt"
+	tf "github.com/glycerine/tmframe"
+	"time"
+)
+
+// ErrFull is returned by Add on a bounded queue when the
+// incoming frame is refused for lack of room.
+var ErrFull = errors.New("pq: queue is at capacity")
+
+// EvictPolicy says what a bounded queue does when Add is
+// called while it already holds MaxLen entries. Every policy
+// that evicts does so through an Evictor, the same as the
+// per-Evtnum budgets, which is told the bound's BoundStats;
+// the policy only names which one, so it can be saved in a
+// snapshot.
+type EvictPolicy int
+
+const (
+	// RejectNewest refuses the incoming frame with ErrFull.
+	RejectNewest EvictPolicy = iota
+
+	// EvictEarliest evicts with OldestEvictor: the entry
+	// with the earliest OrderBy goes.
+	EvictEarliest
+
+	// EvictLatest evicts with NewestEvictor: the entry with
+	// the latest OrderBy goes.
+	EvictLatest
+
+	// EvictByEvictor evicts with pq.Evictor, rejecting the
+	// incoming frame if there is none.
+	EvictByEvictor
+)
+
+func (p EvictPolicy) String() string {
+	switch p {
+	case RejectNewest:
+		return "RejectNewest"
+	case EvictEarliest:
+		return "EvictEarliest"
+	case EvictLatest:
+		return "EvictLatest"
+	case EvictByEvictor:
+		return "EvictByEvictor"
+	}
+	return "EvictPolicy(?)"
+}
+
+// MarshalText encodes p by name, as in JSON configs.
+func (p EvictPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText sets p from its name.
+func (p *EvictPolicy) UnmarshalText(text []byte) error {
+	for q := RejectNewest; q <= EvictByEvictor; q++ {
+		if q.String() == string(text) {
+			*p = q
+			return nil
+		}
+	}
+	return fmt.Errorf("pq: unknown EvictPolicy %q", text)
+}
+
+// BoundStats is the Budget an Evictor is given when a bounded
+// queue is full.
+type BoundStats struct {
+	Len      int // entries queued
+	Reserved int // slots held by open Reservations
+	MaxLen   int // the bound on Len plus Reserved
+}
+
+// NewBoundedPriorityQueue returns a queue that never holds more
+// than max entries added via Add; policy says what gives way
+// when it is full. If the incoming frame itself would be the one
+// evicted (for example, it is earlier than everything queued
+// under EvictEarliest), Add returns ErrFull. Choosing a victim
+// examines every entry, so an eviction is O(n). heap.Push cannot
+// fail, so it bypasses the bound.
+//
+// The built-in Evictors go by OrderBy, even in a queue with a
+// LessFunc.
+func NewBoundedPriorityQueue(max int, policy EvictPolicy) *PriorityQueue {
+	pq := NewPriorityQueue()
+	pq.MaxLen = max
+	pq.Policy = policy
+	return pq
+}
+
+// boundEvictor returns the Evictor pq.Policy names, or nil if
+// the policy evicts nothing.
+func (pq *PriorityQueue) boundEvictor() Evictor {
+	switch pq.Policy {
+	case EvictEarliest:
+		return OldestEvictor{}
+	case EvictLatest:
+		return NewestEvictor{}
+	case EvictByEvictor:
+		return pq.Evictor
+	}
+	return nil
+}
+
+// makeRoom ensures there is space for f under MaxLen, less
+// any outstanding reservations, evicting per pq.Policy. It
+// returns false if f should be rejected instead.
+func (pq *PriorityQueue) makeRoom(f *tf.Frame) bool {
+	if pq.MaxLen <= 0 {
+		return true
+	}
+	if pq.reserved >= pq.MaxLen {
+		return false
+	}
+	ev := pq.boundEvictor()
+	incoming := &Pqe{Val: f, OrderBy: time.Unix(0, f.Tm()), Idx: -1, InsertSeq: pq.nextSeq}
+	for len(pq.Seq)+pq.reserved >= pq.MaxLen {
+		if ev == nil {
+			return false
+		}
+		cands := append(append([]*Pqe(nil), pq.Seq...), incoming)
+		stats := BoundStats{Len: len(pq.Seq), Reserved: pq.reserved, MaxLen: pq.MaxLen}
+		v := ev.ChooseVictim(stats, cands)
+		if v < 0 || v >= len(pq.Seq) {
+			return false
+		}
+		pq.evict(cands[v], ErrFull.Error())
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+)
+
+func Test014BoundedQueuePolicies(t *testing.T) {
+
+	n := 20
+	max := 5
+	frames, _, _ := GenTestFrames(n, nil)
+
+	drain := func(pq *PriorityQueue) (res []*tf.Frame) {
+		for {
+			f, ok := pq.PopFrame()
+			if !ok {
+				return
+			}
+			res = append(res, f)
+		}
+	}
+
+	cv.Convey("RejectNewest should keep the first max frames added and refuse the rest with ErrFull", t, func() {
+		pq := NewBoundedPriorityQueue(max, RejectNewest)
+		full := 0
+		for i := range frames {
+			if _, err := pq.Add(frames[i]); err == ErrFull {
+				full++
+			}
+		}
+		cv.So(full, cv.ShouldEqual, n-max)
+		cv.So(drain(pq), cv.ShouldResemble, frames[:max])
+	})
+
+	cv.Convey("EvictEarliest should keep the latest max frames", t, func() {
+		pq := NewBoundedPriorityQueue(max, EvictEarliest)
+		for i := range frames {
+			_, err := pq.Add(frames[i])
+			cv.So(err, cv.ShouldBeNil)
+		}
+		cv.So(drain(pq), cv.ShouldResemble, frames[n-max:])
+
+		// an arrival earlier than everything queued is itself the earliest.
+		for i := n - max; i < n; i++ {
+			pq.Add(frames[i])
+		}
+		_, err := pq.Add(frames[0])
+		cv.So(err, cv.ShouldEqual, ErrFull)
+	})
+
+	cv.Convey("EvictLatest should keep the earliest max frames, even when they arrive last", t, func() {
+		pq := NewBoundedPriorityQueue(max, EvictLatest)
+		for i := range frames {
+			pq.Add(frames[n-1-i])
+		}
+		cv.So(pq.Len(), cv.ShouldEqual, max)
+		cv.So(drain(pq), cv.ShouldResemble, frames[:max])
+	})
+
+	cv.Convey("EvictByEvictor should defer to pq.Evictor", t, func() {
+		pq := NewBoundedPriorityQueue(max, EvictByEvictor)
+		var budgets []Budget
+		pq.Evictor = EvictorFunc(func(b Budget, cands []*Pqe) int {
+			budgets = append(budgets, b)
+			return OldestEvictor{}.ChooseVictim(b, cands)
+		})
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		cv.So(drain(pq), cv.ShouldResemble, frames[n-max:])
+
+		// the Evictor is told about the bound, not an Evtnum.
+		cv.So(budgets, cv.ShouldHaveLength, n-max)
+		cv.So(budgets[0], cv.ShouldResemble, BoundStats{Len: max, MaxLen: max})
+	})
+}
+
+func Test034ReserveHoldsRoomInABoundedQueue(t *testing.T) {
+
+	cv.Convey("reserved slots should count as occupied until the Reservation is committed or aborted", t, func() {
+
+		frames, _, _ := GenTestFrames(10, nil)
+		pq := NewBoundedPriorityQueue(5, RejectNewest)
+		pq.Add(frames[0])
+
+		r, err := pq.Reserve(3)
+		cv.So(err, cv.ShouldBeNil)
+		_, err = pq.Reserve(2)
+		cv.So(err, cv.ShouldEqual, ErrFull)
+
+		// one free slot is left for ordinary Adds
+		_, err = pq.Add(frames[1])
+		cv.So(err, cv.ShouldBeNil)
+		_, err = pq.Add(frames[2])
+		cv.So(err, cv.ShouldEqual, ErrFull)
+
+		_, err = r.Commit(frames[3:7])
+		cv.So(err, cv.ShouldEqual, ErrOverReservation)
+		added, err := r.Commit(frames[3:5])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(added, cv.ShouldHaveLength, 2)
+		cv.So(pq.Len(), cv.ShouldEqual, 4)
+		_, err = r.Commit(frames[5:6])
+		cv.So(err, cv.ShouldEqual, ErrReservationDone)
+
+		// the unused third slot was released by Commit
+		_, err = pq.Add(frames[5])
+		cv.So(err, cv.ShouldBeNil)
+
+		pq.PopFrame()
+		r, err = pq.Reserve(1)
+		cv.So(err, cv.ShouldBeNil)
+		r.Abort()
+		r.Abort()
+		_, err = pq.Add(frames[6])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(pq.Len(), cv.ShouldEqual, 5)
+	})
+}
@@ -0,0 +1,135 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"sync"
+	"time"
+)
+
+// bridgePoll is how often a Bridge held back by a full queue
+// checks whether the queue has drained.
+const bridgePoll = time.Millisecond
+
+// Bridge moves frames from a BlockingFrameRingBuf into a
+// SyncPriorityQueue on its own goroutine: the ring absorbs
+// bursty input, and the queue puts it in order. Frames move in
+// batches, each added under a single lock of the queue.
+//
+// If the queue holds highWater frames or more, the Bridge stops
+// reading the ring until consumers bring it back under; the
+// ring then fills, and its writers block. That is the
+// backpressure: bursts are bounded by the ring plus highWater,
+// never dropped for lack of room. Frames the queue refuses
+// anyway, for a budget, bound or duplicate, are counted in
+// BridgeStats.Refused.
+//
+// Close the ring to stop the Bridge; it moves what remains
+// in the ring first.
+type Bridge struct {
+	ring      *BlockingFrameRingBuf
+	dst       *SyncPriorityQueue
+	batch     int
+	highWater int
+	exited    chan struct{}
+
+	mu    sync.Mutex
+	stats BridgeStats
+}
+
+// BridgeStats counts a Bridge's transfers.
+type BridgeStats struct {
+	Moved   int64 // frames added to the queue
+	Refused int64 // frames the queue's Add refused
+	Batches int64 // transfers made
+	Stalls  int64 // times the Bridge waited for the queue to drain
+}
+
+// NewBridge starts a Bridge moving up to batch frames at a time
+// from ring to dst. A batch below 1 is taken as 1. A highWater
+// of 0 puts no limit on the queue.
+func NewBridge(ring *BlockingFrameRingBuf, dst *SyncPriorityQueue, batch, highWater int) *Bridge {
+	if batch < 1 {
+		batch = 1
+	}
+	b := &Bridge{
+		ring:      ring,
+		dst:       dst,
+		batch:     batch,
+		highWater: highWater,
+		exited:    make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Wait blocks until the ring has been closed and everything in
+// it moved, then returns the final stats.
+func (b *Bridge) Wait() BridgeStats {
+	<-b.exited
+	return b.Stats()
+}
+
+// Stats returns a snapshot of the transfer counters.
+func (b *Bridge) Stats() BridgeStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+func (b *Bridge) loop() {
+	defer close(b.exited)
+	buf := make([]*tf.Frame, b.batch)
+	for {
+		n := b.room()
+		k, err := b.ring.Read(buf[:n])
+		if k > 0 {
+			b.move(buf[:k])
+		}
+		if err == io.EOF {
+			return
+		}
+	}
+}
+
+// room waits until the queue is under highWater, and returns
+// how many frames the next batch may hold.
+func (b *Bridge) room() int {
+	if b.highWater <= 0 {
+		return b.batch
+	}
+	stalled := false
+	for {
+		free := b.highWater - b.dst.Len()
+		if free > 0 {
+			return intMin(free, b.batch)
+		}
+		if !stalled {
+			stalled = true
+			b.mu.Lock()
+			b.stats.Stalls++
+			b.mu.Unlock()
+		}
+		time.Sleep(bridgePoll)
+	}
+}
+
+// move adds frames to the queue under one lock.
+func (b *Bridge) move(frames []*tf.Frame) {
+	var moved, refused int64
+	b.dst.Do(func(pq *PriorityQueue) {
+		for i, f := range frames {
+			if _, err := pq.Add(f); err != nil {
+				refused++
+			} else {
+				moved++
+			}
+			frames[i] = nil
+		}
+	})
+	b.mu.Lock()
+	b.stats.Moved += moved
+	b.stats.Refused += refused
+	b.stats.Batches++
+	b.mu.Unlock()
+}
@@ -0,0 +1,77 @@
+package pq
+
+import (
+	"context"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+	"time"
+)
+
+func Test056BridgeMovesRingIntoQueue(t *testing.T) {
+
+	cv.Convey("a Bridge should move everything written to the ring into the queue, in batches, for the queue to order", t, func() {
+
+		n := 100
+		frames, _, _ := GenTestFrames(n, nil)
+		ring := NewBlockingFrameRingBuf(16)
+		dst := NewSyncPriorityQueue(nil)
+		br := NewBridge(ring, dst, 8, 0)
+
+		for i := n - 1; i >= 0; i-- {
+			_, err := ring.Write([]*tf.Frame{frames[i]})
+			panicOn(err)
+		}
+		ring.Close()
+		st := br.Wait()
+		cv.So(st.Moved, cv.ShouldEqual, n)
+		cv.So(st.Refused, cv.ShouldEqual, 0)
+		cv.So(st.Batches, cv.ShouldBeLessThanOrEqualTo, n)
+		cv.So(dst.Len(), cv.ShouldEqual, n)
+		for i := 0; i < n; i++ {
+			f, ok := dst.PopFrame()
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(f, cv.ShouldEqual, frames[i])
+		}
+	})
+
+	cv.Convey("a Bridge should stop at the queue's high water, letting the ring fill and block its writer, until consumers catch up; run under -race", t, func() {
+
+		n := 100
+		frames, _, _ := GenTestFrames(n, nil)
+		ring := NewBlockingFrameRingBuf(16)
+		dst := NewSyncPriorityQueue(nil)
+		br := NewBridge(ring, dst, 4, 10)
+
+		wrote := make(chan struct{})
+		go func() {
+			defer close(wrote)
+			ring.Write(frames)
+			ring.Close()
+		}()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for (dst.Len() < 10 || ring.Len() < 16) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		cv.So(dst.Len(), cv.ShouldEqual, 10)
+		cv.So(ring.Len(), cv.ShouldEqual, 16)
+		cv.So(br.Stats().Stalls, cv.ShouldBeGreaterThan, 0)
+		select {
+		case <-wrote:
+			t.Fatal("writer should be blocked on the full ring")
+		default:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for i := 0; i < n; i++ {
+			_, err := dst.WaitPop(ctx)
+			cv.So(err, cv.ShouldBeNil)
+		}
+		<-wrote
+		st := br.Wait()
+		cv.So(st.Moved, cv.ShouldEqual, n)
+		cv.So(dst.Len(), cv.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,46 @@
+package pq
+
+import (
+	"context"
+	tf "github.com/glycerine/tmframe"
+)
+
+// DrainTo sends the queued frames to ch in order until the
+// queue is empty, returning nil, or until ctx is done,
+// returning ctx.Err(). A frame is popped only once ch has
+// accepted it, so cancellation never loses a frame.
+//
+// PriorityQueue has no lock of its own; DrainTo and FeedFrom
+// must not run concurrently on the same queue.
+func (pq *PriorityQueue) DrainTo(ctx context.Context, ch chan<- *tf.Frame) error {
+	for pq.Len() > 0 {
+		select {
+		case ch <- pq.First().Val:
+			pq.PopPqe()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// FeedFrom Adds every frame received on ch to the queue,
+// until ch is closed, returning nil, or ctx is done, returning
+// ctx.Err(). n counts the frames accepted; frames refused by
+// a budget or bound are skipped, as Add reports them in the
+// queue's stats and Journal.
+func (pq *PriorityQueue) FeedFrom(ctx context.Context, ch <-chan *tf.Frame) (n int, err error) {
+	for {
+		select {
+		case f, ok := <-ch:
+			if !ok {
+				return n, nil
+			}
+			if _, err := pq.Add(f); err == nil {
+				n++
+			}
+		case <-ctx.Done():
+			return n, ctx.Err()
+		}
+	}
+}
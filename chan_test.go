@@ -0,0 +1,52 @@
+package pq
+
+import (
+	"context"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+)
+
+func Test025ChannelAdapters(t *testing.T) {
+
+	cv.Convey("FeedFrom then DrainTo should turn an unordered channel into an ordered one", t, func() {
+
+		n := 30
+		frames, _, _ := GenTestFrames(n, nil)
+		in := make(chan *tf.Frame)
+		go func() {
+			for i := range frames {
+				in <- frames[n-1-i]
+			}
+			close(in)
+		}()
+
+		pq := NewPriorityQueue()
+		k, err := pq.FeedFrom(context.Background(), in)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(k, cv.ShouldEqual, n)
+
+		out := make(chan *tf.Frame, n)
+		cv.So(pq.DrainTo(context.Background(), out), cv.ShouldBeNil)
+		close(out)
+		i := 0
+		for f := range out {
+			cv.So(f, cv.ShouldEqual, frames[i])
+			i++
+		}
+		cv.So(i, cv.ShouldEqual, n)
+	})
+
+	cv.Convey("a cancelled DrainTo should leave unsent frames queued", t, func() {
+
+		frames, _, _ := GenTestFrames(5, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		cv.So(pq.DrainTo(ctx, make(chan *tf.Frame)), cv.ShouldEqual, context.Canceled)
+		cv.So(pq.Len(), cv.ShouldEqual, 5)
+	})
+}
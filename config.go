@@ -0,0 +1,264 @@
+package pq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config gathers the options of a queue, and of a Reorderer
+// built on one, so that a service can set up its pipeline in
+// one place, from JSON or the environment, and learn of
+// nonsensical combinations from Validate rather than from
+// surprising behaviour later. The zero Config is a plain
+// unbounded queue.
+type Config struct {
+	// MaxLen and Policy bound the queue; see NewBoundedPriorityQueue.
+	MaxLen int         `json:"max_len"`
+	Policy EvictPolicy `json:"policy"`
+
+	// Evictor names the built-in Evictor, "oldest", "newest" or
+	// "largest", used by EvictByEvictor and the Budgets. Empty
+	// means none.
+	Evictor string `json:"evictor"`
+
+	// Budgets sets per-Evtnum budgets; see SetEvtnumBudget.
+	Budgets map[tf.Evtnum]EvtnumBudget `json:"budgets"`
+
+	// Dedup turns on duplicate detection by FrameKey; see SetDedup.
+	Dedup DedupMode `json:"dedup"`
+
+	// Less, if set, replaces ordering by time; see
+	// NewPriorityQueueWithLess. It can only be set in code.
+	Less func(a, b *Pqe) bool `json:"-"`
+
+	// Lateness, EventTime and MaxLatency configure a Reorderer;
+	// see its fields. In JSON they are duration strings such as
+	// "5s".
+	Lateness   time.Duration `json:"-"`
+	EventTime  bool          `json:"event_time"`
+	MaxLatency time.Duration `json:"-"`
+
+	// Now is the Reorderer's clock, time.Now if nil. It can
+	// only be set in code.
+	Now func() time.Time `json:"-"`
+}
+
+// EvtnumBudget is one Evtnum's limits in a Config. A zero
+// limit means unlimited.
+type EvtnumBudget struct {
+	MaxCount int64 `json:"max_count"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// Validate reports every problem with c, joined into one error,
+// or nil if c makes sense.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("pq: config: "+format, args...))
+	}
+	if c.MaxLen < 0 {
+		bad("max_len %d is negative", c.MaxLen)
+	}
+	switch c.Policy {
+	case RejectNewest, EvictEarliest, EvictLatest, EvictByEvictor:
+	default:
+		bad("unknown policy %d", int(c.Policy))
+	}
+	if c.MaxLen <= 0 && c.Policy != RejectNewest {
+		bad("policy %v has no effect without max_len", c.Policy)
+	}
+	if c.Less != nil && (c.Policy == EvictEarliest || c.Policy == EvictLatest) {
+		bad("policy %v evicts by time, which disagrees with a custom Less; use EvictByEvictor", c.Policy)
+	}
+	if _, ok := builtinEvictors[c.Evictor]; !ok {
+		bad("unknown evictor %q", c.Evictor)
+	}
+	if c.Policy == EvictByEvictor && c.Evictor == "" {
+		bad("policy EvictByEvictor needs an evictor")
+	}
+	for ev, b := range c.Budgets {
+		if b.MaxCount < 0 || b.MaxBytes < 0 {
+			bad("budget for Evtnum %d is negative", ev)
+		}
+	}
+	switch c.Dedup {
+	case DedupOff, DedupReject, DedupReplace:
+	default:
+		bad("unknown dedup mode %d", int(c.Dedup))
+	}
+	if c.Lateness < 0 {
+		bad("lateness %v is negative", c.Lateness)
+	}
+	if c.MaxLatency < 0 {
+		bad("max_latency %v is negative", c.MaxLatency)
+	}
+	return errors.Join(errs...)
+}
+
+// builtinEvictors maps Config.Evictor names to Evictors.
+var builtinEvictors = map[string]Evictor{
+	"":        nil,
+	"oldest":  OldestEvictor{},
+	"newest":  NewestEvictor{},
+	"largest": LargestEvictor{},
+}
+
+// NewQueue validates c and returns a queue configured by it.
+func (c *Config) NewQueue() (*PriorityQueue, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	pq := NewPriorityQueue()
+	pq.LessFunc = c.Less
+	pq.MaxLen = c.MaxLen
+	pq.Policy = c.Policy
+	pq.Evictor = builtinEvictors[c.Evictor]
+	for ev, b := range c.Budgets {
+		pq.SetEvtnumBudget(ev, b.MaxCount, b.MaxBytes)
+	}
+	if c.Dedup != DedupOff {
+		pq.SetDedup(c.Dedup, nil)
+	}
+	return pq, nil
+}
+
+// NewReorderer validates c and returns a Reorderer configured
+// by it, holding frames in a queue from NewQueue.
+func (c *Config) NewReorderer() (*Reorderer, error) {
+	pq, err := c.NewQueue()
+	if err != nil {
+		return nil, err
+	}
+	r := NewReorderer(c.Lateness)
+	r.pq = pq
+	r.EventTime = c.EventTime
+	r.MaxLatency = c.MaxLatency
+	if c.Now != nil {
+		r.Now = c.Now
+	}
+	return r, nil
+}
+
+// ConfigFromJSON reads a Config from JSON, refusing unknown
+// fields, and validates it. Policy and dedup are given by name,
+// as in "EvictEarliest", and budgets are keyed by Evtnum.
+func ConfigFromJSON(r io.Reader) (*Config, error) {
+	type plain Config
+	var in struct {
+		*plain
+		Lateness   string `json:"lateness"`
+		MaxLatency string `json:"max_latency"`
+	}
+	c := &Config{}
+	in.plain = (*plain)(c)
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return nil, fmt.Errorf("pq: config: %v", err)
+	}
+	var err error
+	if c.Lateness, err = parseConfigDuration("lateness", in.Lateness); err != nil {
+		return nil, err
+	}
+	if c.MaxLatency, err = parseConfigDuration("max_latency", in.MaxLatency); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ConfigFromEnv reads a Config from environment variables named
+// prefix plus MAX_LEN, POLICY, EVICTOR, DEDUP, LATENESS,
+// EVENT_TIME and MAX_LATENCY, and validates it. BUDGETS is a
+// comma-separated list of evtnum:maxCount:maxBytes. Unset
+// variables leave their field at its zero value.
+func ConfigFromEnv(prefix string) (*Config, error) {
+	c := &Config{}
+	get := func(name string) (string, bool) {
+		v, ok := os.LookupEnv(prefix + name)
+		return v, ok && v != ""
+	}
+	var err error
+	if v, ok := get("MAX_LEN"); ok {
+		if c.MaxLen, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("pq: config: %sMAX_LEN: %v", prefix, err)
+		}
+	}
+	if v, ok := get("POLICY"); ok {
+		if err = c.Policy.UnmarshalText([]byte(v)); err != nil {
+			return nil, err
+		}
+	}
+	c.Evictor, _ = get("EVICTOR")
+	if v, ok := get("DEDUP"); ok {
+		if err = c.Dedup.UnmarshalText([]byte(v)); err != nil {
+			return nil, err
+		}
+	}
+	v, _ := get("LATENESS")
+	if c.Lateness, err = parseConfigDuration(prefix+"LATENESS", v); err != nil {
+		return nil, err
+	}
+	v, _ = get("MAX_LATENCY")
+	if c.MaxLatency, err = parseConfigDuration(prefix+"MAX_LATENCY", v); err != nil {
+		return nil, err
+	}
+	if v, ok := get("EVENT_TIME"); ok {
+		if c.EventTime, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("pq: config: %sEVENT_TIME: %v", prefix, err)
+		}
+	}
+	if v, ok := get("BUDGETS"); ok {
+		c.Budgets = make(map[tf.Evtnum]EvtnumBudget)
+		for _, item := range strings.Split(v, ",") {
+			ev, b, err := parseEvtnumBudget(item)
+			if err != nil {
+				return nil, fmt.Errorf("pq: config: %sBUDGETS: %v", prefix, err)
+			}
+			c.Budgets[ev] = b
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseConfigDuration parses s, if not empty, as a duration.
+func parseConfigDuration(name, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("pq: config: %s: %v", name, err)
+	}
+	return d, nil
+}
+
+// parseEvtnumBudget parses evtnum:maxCount:maxBytes.
+func parseEvtnumBudget(s string) (tf.Evtnum, EvtnumBudget, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 3 {
+		return 0, EvtnumBudget{}, fmt.Errorf("%q is not evtnum:maxCount:maxBytes", s)
+	}
+	var n [3]int64
+	for i, p := range parts {
+		v, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return 0, EvtnumBudget{}, fmt.Errorf("%q: %v", s, err)
+		}
+		n[i] = v
+	}
+	return tf.Evtnum(n[0]), EvtnumBudget{MaxCount: n[1], MaxBytes: n[2]}, nil
+}
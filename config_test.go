@@ -0,0 +1,89 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test064ConfigBuildsThePipeline(t *testing.T) {
+
+	cv.Convey("a Config loaded from JSON should build a Reorderer over a queue with the bound, budgets and dedup it names", t, func() {
+
+		c, err := ConfigFromJSON(strings.NewReader(`{
+			"max_len": 4,
+			"policy": "EvictEarliest",
+			"budgets": {"3": {"max_count": 1}},
+			"dedup": "DedupReject",
+			"lateness": "5s",
+			"max_latency": "250ms",
+			"event_time": true
+		}`))
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(c.Lateness, cv.ShouldEqual, 5*time.Second)
+		cv.So(c.MaxLatency, cv.ShouldEqual, 250*time.Millisecond)
+
+		r, err := c.NewReorderer()
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(r.Lateness, cv.ShouldEqual, 5*time.Second)
+		cv.So(r.EventTime, cv.ShouldBeTrue)
+		cv.So(r.pq.MaxLen, cv.ShouldEqual, 4)
+		cv.So(r.pq.Policy, cv.ShouldEqual, EvictEarliest)
+		cv.So(r.pq.EvtnumStatsFor(tf.Evtnum(3)).MaxCount, cv.ShouldEqual, int64(1))
+
+		frames, _, _ := GenTestFrames(1, nil)
+		cv.So(r.Add(frames[0]), cv.ShouldBeNil)
+		cv.So(r.Add(frames[0]), cv.ShouldEqual, ErrDuplicate)
+	})
+
+	cv.Convey("Validate should report every nonsensical setting at once", t, func() {
+
+		c := &Config{
+			MaxLen:   -1,
+			Policy:   EvictByEvictor,
+			Evictor:  "fastest",
+			Budgets:  map[tf.Evtnum]EvtnumBudget{7: {MaxCount: -2}},
+			Lateness: -time.Second,
+		}
+		err := c.Validate()
+		cv.So(err, cv.ShouldNotBeNil)
+		for _, want := range []string{"max_len -1", "no effect without max_len", `unknown evictor "fastest"`, "Evtnum 7", "lateness -1s"} {
+			cv.So(err.Error(), cv.ShouldContainSubstring, want)
+		}
+
+		c = &Config{MaxLen: 3, Policy: EvictLatest, Less: func(a, b *Pqe) bool { return a.InsertSeq < b.InsertSeq }}
+		cv.So(c.Validate(), cv.ShouldNotBeNil)
+		_, err = c.NewQueue()
+		cv.So(err, cv.ShouldNotBeNil)
+
+		_, err = ConfigFromJSON(strings.NewReader(`{"max_len": 3, "polcy": "EvictLatest"}`))
+		cv.So(err, cv.ShouldNotBeNil)
+		_, err = ConfigFromJSON(strings.NewReader(`{"policy": "EvictSometimes"}`))
+		cv.So(err, cv.ShouldNotBeNil)
+	})
+
+	cv.Convey("ConfigFromEnv should read the same settings from prefixed variables", t, func() {
+
+		t.Setenv("PQTEST_MAX_LEN", "10")
+		t.Setenv("PQTEST_POLICY", "EvictByEvictor")
+		t.Setenv("PQTEST_EVICTOR", "largest")
+		t.Setenv("PQTEST_LATENESS", "2s")
+		t.Setenv("PQTEST_BUDGETS", "3:5:0, 7:0:4096")
+		c, err := ConfigFromEnv("PQTEST_")
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(c.MaxLen, cv.ShouldEqual, 10)
+		cv.So(c.Policy, cv.ShouldEqual, EvictByEvictor)
+		cv.So(c.Lateness, cv.ShouldEqual, 2*time.Second)
+		cv.So(c.Budgets, cv.ShouldResemble, map[tf.Evtnum]EvtnumBudget{3: {MaxCount: 5}, 7: {MaxBytes: 4096}})
+
+		pq, err := c.NewQueue()
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(pq.Evictor, cv.ShouldResemble, LargestEvictor{})
+
+		t.Setenv("PQTEST_BUDGETS", "3:5")
+		_, err = ConfigFromEnv("PQTEST_")
+		cv.So(err, cv.ShouldNotBeNil)
+	})
+}
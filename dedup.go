@@ -0,0 +1,128 @@
+package pq
+
+import (
+	"errors"
+	"fmt"
+	tf "github.com/glycerine/tmframe"
+	"hash/fnv"
+	"strconv"
+)
+
+// ErrDuplicate is returned by Add, in a dedup mode, when the
+// queue already holds a frame with the same key.
+var ErrDuplicate = errors.New("pq: duplicate frame")
+
+// DedupMode says what Add does with a frame whose key matches
+// one already queued.
+type DedupMode int
+
+const (
+	// DedupOff queues duplicates like any other frame.
+	DedupOff DedupMode = iota
+
+	// DedupReject leaves the queued frame in place and refuses
+	// the new one.
+	DedupReject
+
+	// DedupReplace swaps the new frame in for the queued one,
+	// as Update would.
+	DedupReplace
+)
+
+func (m DedupMode) String() string {
+	switch m {
+	case DedupOff:
+		return "DedupOff"
+	case DedupReject:
+		return "DedupReject"
+	case DedupReplace:
+		return "DedupReplace"
+	}
+	return "DedupMode(?)"
+}
+
+// MarshalText encodes m by name, as in JSON configs.
+func (m DedupMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText sets m from its name.
+func (m *DedupMode) UnmarshalText(text []byte) error {
+	for d := DedupOff; d <= DedupReplace; d++ {
+		if d.String() == string(text) {
+			*m = d
+			return nil
+		}
+	}
+	return fmt.Errorf("pq: unknown DedupMode %q", text)
+}
+
+// FrameKey is the default dedup key: the timestamp plus an
+// FNV-1a hash of the marshalled frame, so only byte-identical
+// frames collide.
+func FrameKey(f *tf.Frame) string {
+	by, err := f.Marshal(nil)
+	if err != nil {
+		return strconv.FormatInt(f.Tm(), 10)
+	}
+	h := fnv.New64a()
+	h.Write(by)
+	return strconv.FormatInt(f.Tm(), 10) + "/" + strconv.FormatUint(h.Sum64(), 16)
+}
+
+// SetDedup turns on duplicate detection in Add, keyed by key,
+// or by FrameKey if key is nil. Frames already queued are
+// indexed at once; if they hold duplicates among themselves,
+// all are kept. DedupOff turns detection off and drops the
+// index. Either way, Add returns ErrDuplicate on a match,
+// along with the entry now holding that key.
+//
+// Keys are tracked through Add, Update, heap.Push and
+// heap.Pop; an Update that gives an entry the key of another
+// is not checked.
+func (pq *PriorityQueue) SetDedup(mode DedupMode, key func(*tf.Frame) string) {
+	pq.dedupMode = mode
+	pq.dedup = nil
+	if mode == DedupOff {
+		pq.dedupKey = nil
+		return
+	}
+	if key == nil {
+		key = FrameKey
+	}
+	pq.dedupKey = key
+	pq.dedup = make(map[string]*Pqe, len(pq.Seq))
+	for _, pqe := range pq.Seq {
+		pq.dedupTrack(pqe)
+	}
+}
+
+// dedupLookup returns the queued entry sharing f's key, if any.
+func (pq *PriorityQueue) dedupLookup(f *tf.Frame) *Pqe {
+	if pq.dedup == nil {
+		return nil
+	}
+	return pq.dedup[pq.dedupKey(f)]
+}
+
+// dedupTrack indexes pqe under the key of its frame.
+func (pq *PriorityQueue) dedupTrack(pqe *Pqe) {
+	if pq.dedup == nil {
+		return
+	}
+	pqe.dkey = pq.dedupKey(pqe.Val)
+	if _, dup := pq.dedup[pqe.dkey]; !dup {
+		pq.dedup[pqe.dkey] = pqe
+	}
+}
+
+// dedupForget removes pqe from the index.
+func (pq *PriorityQueue) dedupForget(pqe *Pqe) {
+	if pq.dedup == nil {
+		return
+	}
+	if pq.dedup[pqe.dkey] == pqe {
+		delete(pq.dedup, pqe.dkey)
+	}
+	pqe.dkey = ""
+}
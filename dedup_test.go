@@ -0,0 +1,68 @@
+package pq
+
+import (
+	"fmt"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+	"time"
+)
+
+func Test037DedupRejectsOrReplacesDuplicates(t *testing.T) {
+
+	cv.Convey("replaying overlapping captures into a DedupReject queue should queue each frame once", t, func() {
+
+		n := 30
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		pq.SetDedup(DedupReject, nil)
+
+		dups := 0
+		for _, f := range frames[:20] {
+			pq.Add(f)
+		}
+		// the second capture overlaps the first by ten frames,
+		// and decodes into fresh copies.
+		for _, f := range frames[10:] {
+			by, err := f.Marshal(nil)
+			panicOn(err)
+			var cp tf.Frame
+			_, err = cp.Unmarshal(by, false)
+			panicOn(err)
+			pqe, err := pq.Add(&cp)
+			if err == ErrDuplicate {
+				dups++
+				cv.So(pqe.Val, cv.ShouldNotEqual, &cp)
+			}
+		}
+		cv.So(dups, cv.ShouldEqual, 10)
+		cv.So(pq.Len(), cv.ShouldEqual, n)
+
+		// once popped, a key may be queued again.
+		f, _ := pq.PopFrame()
+		_, err := pq.Add(f)
+		cv.So(err, cv.ShouldBeNil)
+	})
+
+	cv.Convey("a DedupReplace queue with a user key should swap in the newer frame", t, func() {
+
+		frames, _, _ := GenTestFrames(6, nil)
+		pq := NewPriorityQueue()
+		pq.SetDedup(DedupReplace, func(f *tf.Frame) string { return fmt.Sprint(f.Tm()) })
+		for _, f := range frames {
+			pq.Add(f)
+		}
+		fix, err := tf.NewFrame(time.Unix(0, frames[2].Tm()), tf.EvOneFloat64, 42, 0, nil)
+		panicOn(err)
+		pqe, err := pq.Add(fix)
+		cv.So(err, cv.ShouldEqual, ErrDuplicate)
+		cv.So(pqe.Val, cv.ShouldEqual, fix)
+		cv.So(pq.Len(), cv.ShouldEqual, 6)
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+
+		pq.SetDedup(DedupOff, nil)
+		_, err = pq.Add(fix)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(pq.Len(), cv.ShouldEqual, 7)
+	})
+}
@@ -0,0 +1,219 @@
+package pq
+
+import (
+	"bufio"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"os"
+	"sort"
+)
+
+// DiskBackedPQ is a priority queue of frames that keeps at most
+// MaxMem frames in memory. When an Add would exceed that, the
+// latest half of the in-memory frames are written, sorted, to a
+// tmframe run file in Dir. Pop merges the in-memory head with the
+// heads of the run files, so frames still come out in time order
+// while only one frame per run is held in RAM.
+//
+// Frames with equal timestamps may come out in any order once
+// some of them have been spilled. A DiskBackedPQ is not safe for
+// concurrent use; call Close to remove its run files.
+type DiskBackedPQ struct {
+	Dir    string
+	MaxMem int
+
+	mem    *PriorityQueue
+	heads  *PriorityQueue // the next unread frame of each run
+	from   map[*Pqe]*spillRun
+	broken []*spillRun // runs whose first frame could not be read
+	n      int
+}
+
+// spillRun is one sorted run file being read back.
+type spillRun struct {
+	path string
+	f    *os.File
+	src  FrameSource
+}
+
+// NewDiskBackedPQ returns an empty queue spilling to run
+// files in dir (os.TempDir() if dir is empty). maxMem is
+// raised to 2 if smaller, so each spill frees some room.
+func NewDiskBackedPQ(dir string, maxMem int) *DiskBackedPQ {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if maxMem < 2 {
+		maxMem = 2
+	}
+	return &DiskBackedPQ{
+		Dir:    dir,
+		MaxMem: maxMem,
+		mem:    NewPriorityQueue(),
+		heads:  NewPriorityQueue(),
+		from:   make(map[*Pqe]*spillRun),
+	}
+}
+
+// Len returns the number of frames queued, in memory and on disk.
+func (d *DiskBackedPQ) Len() int {
+	return d.n
+}
+
+// Runs returns the number of run files still being read.
+func (d *DiskBackedPQ) Runs() int {
+	return len(d.from) + len(d.broken)
+}
+
+// Add queues f, spilling to disk first if memory is full.
+func (d *DiskBackedPQ) Add(f *tf.Frame) error {
+	if d.mem.Len() >= d.MaxMem {
+		if err := d.spill(); err != nil {
+			return err
+		}
+	}
+	if _, err := d.mem.Add(f); err != nil {
+		return err
+	}
+	d.n++
+	return nil
+}
+
+// Pop removes and returns the earliest frame, or io.EOF if
+// the queue is empty. If a run file cannot be read, Pop returns
+// a nil frame and the error, and removes nothing: until a later
+// Pop succeeds in reading the run, no frame can safely be called
+// earliest, so each Pop retries it and returns its error again. If frames
+// counted by Len have vanished, as when a run file was cut
+// short, Pop returns io.ErrUnexpectedEOF and empties the queue.
+func (d *DiskBackedPQ) Pop() (*tf.Frame, error) {
+	if d.n == 0 {
+		return nil, io.EOF
+	}
+	for len(d.broken) > 0 {
+		if err := d.advance(d.broken[0]); err != nil {
+			return nil, err
+		}
+		d.broken = d.broken[1:]
+	}
+	if d.heads.Len() == 0 && d.mem.Len() == 0 {
+		d.n = 0
+		return nil, io.ErrUnexpectedEOF
+	}
+	if d.heads.Len() == 0 || (d.mem.Len() > 0 && !d.heads.First().OrderBy.Before(d.mem.First().OrderBy)) {
+		f, _ := d.mem.PopFrame()
+		d.n--
+		return f, nil
+	}
+	pqe, _ := d.heads.PopPqe()
+	run := d.from[pqe]
+	delete(d.from, pqe)
+	if err := d.advance(run); err != nil {
+		// the frame stays the run's head until the run reads again.
+		back, _ := d.heads.Add(pqe.Val)
+		d.from[back] = run
+		return nil, err
+	}
+	d.n--
+	return pqe.Val, nil
+}
+
+// Close removes any remaining run files. The queue is empty afterwards.
+func (d *DiskBackedPQ) Close() error {
+	var first error
+	for pqe, run := range d.from {
+		if err := run.close(); err != nil && first == nil {
+			first = err
+		}
+		delete(d.from, pqe)
+	}
+	for _, run := range d.broken {
+		if err := run.close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	d.broken = nil
+	d.mem = NewPriorityQueue()
+	d.heads = NewPriorityQueue()
+	d.n = 0
+	return first
+}
+
+// spill moves the latest half of the in-memory frames to a new
+// sorted run file, and queues that run's first frame. If that
+// frame cannot be read back, the run is kept for Pop to retry.
+func (d *DiskBackedPQ) spill() error {
+	all := make([]*Pqe, len(d.mem.Seq))
+	copy(all, d.mem.Seq)
+	sort.Stable(pqeByTime(all))
+	keep := len(all) / 2
+
+	fd, err := os.CreateTemp(d.Dir, "pq-run-*.tf")
+	if err != nil {
+		return err
+	}
+	run := &spillRun{path: fd.Name()}
+	w := bufio.NewWriter(fd)
+	var buf []byte
+	for _, pqe := range all[keep:] {
+		buf, err = pqe.Val.Marshal(buf[:0])
+		if err == nil {
+			_, err = w.Write(buf)
+		}
+		if err != nil {
+			fd.Close()
+			os.Remove(run.path)
+			return err
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = fd.Close()
+	}
+	if err != nil {
+		os.Remove(run.path)
+		return err
+	}
+
+	run.f, err = os.Open(run.path)
+	if err != nil {
+		os.Remove(run.path)
+		return err
+	}
+	run.src = NewReaderSource(bufio.NewReader(run.f))
+
+	mem := NewPriorityQueue()
+	for _, pqe := range all[:keep] {
+		mem.Add(pqe.Val)
+	}
+	d.mem = mem
+	if err := d.advance(run); err != nil {
+		d.broken = append(d.broken, run)
+		return err
+	}
+	return nil
+}
+
+// advance queues the next frame of run, or retires run at its end.
+func (d *DiskBackedPQ) advance(run *spillRun) error {
+	f, err := run.src.NextFrame()
+	if err == io.EOF {
+		return run.close()
+	}
+	if err != nil {
+		return err
+	}
+	pqe, err := d.heads.Add(f)
+	if err != nil {
+		return err
+	}
+	d.from[pqe] = run
+	return nil
+}
+
+func (r *spillRun) close() error {
+	err := r.f.Close()
+	if rerr := os.Remove(r.path); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package pq
+
+import (
+	"container/heap"
+	"errors"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func Test026DiskBackedPQSpillsAndMergesBack(t *testing.T) {
+
+	cv.Convey("a DiskBackedPQ with a small memory budget should still pop every frame in order", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-spill")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+
+		n := 300
+		frames, _, _ := GenTestFrames(n, nil)
+		d := NewDiskBackedPQ(dir, 16)
+
+		// a scrambled arrival order, so spilled runs keep being overtaken.
+		added := map[int]bool{}
+		for i := 0; i < n; i++ {
+			j := (i * 7919) % n
+			cv.So(d.Add(frames[j]), cv.ShouldBeNil)
+			added[j] = true
+		}
+		cv.So(len(added), cv.ShouldEqual, n)
+		cv.So(d.Len(), cv.ShouldEqual, n)
+		cv.So(d.Runs(), cv.ShouldBeGreaterThan, 1)
+
+		for i := 0; i < n; i++ {
+			f, err := d.Pop()
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(f.Tm(), cv.ShouldEqual, frames[i].Tm())
+		}
+		_, err = d.Pop()
+		cv.So(err, cv.ShouldEqual, io.EOF)
+		cv.So(d.Runs(), cv.ShouldEqual, 0)
+
+		left, _ := ioutil.ReadDir(dir)
+		cv.So(len(left), cv.ShouldEqual, 0)
+		cv.So(d.Close(), cv.ShouldBeNil)
+	})
+}
+
+// flakySource fails its first fail reads, then reads src.
+type flakySource struct {
+	src  FrameSource
+	fail int
+}
+
+func (s *flakySource) NextFrame() (*tf.Frame, error) {
+	if s.fail > 0 {
+		s.fail--
+		return nil, errors.New("flaky read")
+	}
+	return s.src.NextFrame()
+}
+
+// cutSource ends early, as a truncated run file would.
+type cutSource struct{}
+
+func (cutSource) NextFrame() (*tf.Frame, error) { return nil, io.EOF }
+
+func Test053DiskBackedPQRunReadErrors(t *testing.T) {
+
+	cv.Convey("a run that fails to read should keep failing Pop until it reads again, losing no frames", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-spill")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+
+		n := 40
+		frames, _, _ := GenTestFrames(n, nil)
+		d := NewDiskBackedPQ(dir, 8)
+		for i := 0; i < n; i++ {
+			cv.So(d.Add(frames[i]), cv.ShouldBeNil)
+		}
+		cv.So(d.Runs(), cv.ShouldBeGreaterThan, 0)
+		for _, run := range d.from {
+			run.src = &flakySource{src: run.src, fail: 2}
+		}
+
+		got := 0
+		errs := 0
+		for {
+			f, err := d.Pop()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				cv.So(f, cv.ShouldBeNil)
+				cv.So(d.Len(), cv.ShouldEqual, n-got)
+				errs++
+				continue
+			}
+			cv.So(f.Tm(), cv.ShouldEqual, frames[got].Tm())
+			got++
+		}
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(errs, cv.ShouldBeGreaterThan, 0)
+		cv.So(d.Len(), cv.ShouldEqual, 0)
+		cv.So(d.Close(), cv.ShouldBeNil)
+	})
+
+	cv.Convey("a run whose first frame could not be read back at spill time should be retried by Pop", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-spill")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+
+		n := 20
+		frames, _, _ := GenTestFrames(n, nil)
+		d := NewDiskBackedPQ(dir, 8)
+		for i := 0; i < n; i++ {
+			cv.So(d.Add(frames[i]), cv.ShouldBeNil)
+		}
+		// put one run back in the state a failed spill leaves it:
+		// tracked, but with its first frame unread.
+		for pqe, run := range d.from {
+			heap.Remove(d.heads, pqe.Idx)
+			delete(d.from, pqe)
+			run.src = &flakySource{fail: 1, src: &oneThenSource{f: pqe.Val, then: run.src}}
+			d.broken = append(d.broken, run)
+			break
+		}
+		runs := d.Runs()
+
+		f, err := d.Pop()
+		cv.So(f, cv.ShouldBeNil)
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(d.Runs(), cv.ShouldEqual, runs)
+		for i := 0; i < n; i++ {
+			f, err := d.Pop()
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(f.Tm(), cv.ShouldEqual, frames[i].Tm())
+		}
+		_, err = d.Pop()
+		cv.So(err, cv.ShouldEqual, io.EOF)
+		cv.So(d.Close(), cv.ShouldBeNil)
+	})
+
+	cv.Convey("a run cut short should make Pop report the lost frames instead of returning a nil frame", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-spill")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+
+		n := 20
+		frames, _, _ := GenTestFrames(n, nil)
+		d := NewDiskBackedPQ(dir, 8)
+		for i := 0; i < n; i++ {
+			cv.So(d.Add(frames[i]), cv.ShouldBeNil)
+		}
+		for _, run := range d.from {
+			run.src = cutSource{}
+		}
+
+		for {
+			f, err := d.Pop()
+			if err != nil {
+				cv.So(err, cv.ShouldEqual, io.ErrUnexpectedEOF)
+				break
+			}
+			cv.So(f, cv.ShouldNotBeNil)
+		}
+		cv.So(d.Len(), cv.ShouldEqual, 0)
+		_, err = d.Pop()
+		cv.So(err, cv.ShouldEqual, io.EOF)
+		cv.So(d.Close(), cv.ShouldBeNil)
+	})
+}
@@ -0,0 +1,37 @@
+package pq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DumpDot writes the current heap to w as a Graphviz DOT
+// digraph: one node per entry, labelled with its heap index,
+// OrderBy timestamp, and Evtnum, and an edge from each parent
+// to its children. Render it with, for example,
+//
+//	dot -Tsvg heap.dot > heap.svg
+func (pq *PriorityQueue) DumpDot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph pq {\n")
+	fmt.Fprintf(bw, "  node [shape=box, fontname=\"monospace\"];\n")
+	for i, pqe := range pq.Seq {
+		ev := "nil"
+		if pqe.Val != nil {
+			ev = fmt.Sprintf("%v", pqe.Val.GetEvtnum())
+		}
+		fmt.Fprintf(bw, "  n%d [label=\"%d: %s\\nEvtnum %s\"];\n",
+			i, i, pqe.OrderBy.UTC().Format(time.RFC3339Nano), ev)
+	}
+	for i := range pq.Seq {
+		for _, c := range []int{2*i + 1, 2*i + 2} {
+			if c < len(pq.Seq) {
+				fmt.Fprintf(bw, "  n%d -> n%d;\n", i, c)
+			}
+		}
+	}
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
@@ -0,0 +1,112 @@
+package pq
+
+import (
+	"container/heap"
+	tf "github.com/glycerine/tmframe"
+)
+
+// Evictor decides what gives way when adding a frame would
+// exceed a budget. candidates holds the queued entries competing
+// for the budget, followed last by a Pqe for the incoming frame
+// (whose Idx is -1). ChooseVictim returns the index in candidates
+// of the entry to evict. Choosing the incoming frame, or returning
+// -1, rejects the incoming frame instead.
+type Evictor interface {
+	ChooseVictim(budget Budget, candidates []*Pqe) int
+}
+
+// Budget is the limit an Evictor is asked to make room under:
+// an EvtnumStats for a per-Evtnum budget, or a BoundStats for
+// a bounded queue's MaxLen. Counts in it are as they would
+// stand after the victims already chosen for this frame go.
+type Budget interface {
+	budget()
+}
+
+func (EvtnumStats) budget() {}
+func (BoundStats) budget()  {}
+
+// EvictorFunc adapts an ordinary function to the Evictor interface.
+type EvictorFunc func(budget Budget, candidates []*Pqe) int
+
+func (f EvictorFunc) ChooseVictim(budget Budget, candidates []*Pqe) int {
+	return f(budget, candidates)
+}
+
+// OldestEvictor evicts the candidate with the earliest OrderBy.
+type OldestEvictor struct{}
+
+func (OldestEvictor) ChooseVictim(budget Budget, candidates []*Pqe) int {
+	return pickBest(candidates, func(a, b *Pqe) bool { return a.OrderBy.Before(b.OrderBy) })
+}
+
+// NewestEvictor evicts the candidate with the latest OrderBy.
+// With in-order arrivals that is usually the incoming frame.
+type NewestEvictor struct{}
+
+func (NewestEvictor) ChooseVictim(budget Budget, candidates []*Pqe) int {
+	return pickBest(candidates, func(a, b *Pqe) bool { return a.OrderBy.After(b.OrderBy) })
+}
+
+// LargestEvictor evicts the candidate whose frame is largest
+// according to Size (DefaultSizeFunc if nil).
+type LargestEvictor struct {
+	Size SizeFunc
+}
+
+func (e LargestEvictor) ChooseVictim(budget Budget, candidates []*Pqe) int {
+	size := e.Size
+	if size == nil {
+		size = DefaultSizeFunc
+	}
+	return pickBest(candidates, func(a, b *Pqe) bool { return size(a.Val) > size(b.Val) })
+}
+
+// LowestPriorityEvictor evicts the candidate whose frame has
+// the smallest Priority.
+type LowestPriorityEvictor struct {
+	Priority func(f *tf.Frame) int
+}
+
+func (e LowestPriorityEvictor) ChooseVictim(budget Budget, candidates []*Pqe) int {
+	return pickBest(candidates, func(a, b *Pqe) bool { return e.Priority(a.Val) < e.Priority(b.Val) })
+}
+
+// pickBest returns the index of the candidate ranked first by
+// better. Ties go to the earlier candidate, so a queued entry
+// is preferred over the incoming frame.
+func pickBest(candidates []*Pqe, better func(a, b *Pqe) bool) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+	best := 0
+	for i := 1; i < len(candidates); i++ {
+		if better(candidates[i], candidates[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// evict takes pqe out of the queue on behalf of a budget or
+// bound, recording JournalEvict rather than the JournalPop a
+// consumer's heap.Remove would, so evictions are not mistaken
+// for deliveries.
+func (pq *PriorityQueue) evict(pqe *Pqe, reason string) {
+	i := pqe.Idx
+	n := len(pq.Seq) - 1
+	if i != n {
+		pq.Swap(i, n)
+	}
+	pq.Seq[n] = nil
+	pq.Seq = pq.Seq[:n]
+	if i < n {
+		heap.Fix(pq, i)
+	}
+	pqe.Idx = -1
+	pqe.Gen++
+	pq.account(pqe.Val, -1)
+	pq.dedupForget(pqe)
+	pq.indexForget(pqe)
+	pq.record(JournalEvict, pqe.OrderBy, reason)
+}
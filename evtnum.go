@@ -0,0 +1,153 @@
+package pq
+
+import (
+	"errors"
+	tf "github.com/glycerine/tmframe"
+	"time"
+)
+
+// ErrEvtnumBudget is returned by Add when accepting the frame
+// would exceed the budget set for its Evtnum.
+var ErrEvtnumBudget = errors.New("pq: Evtnum budget exceeded")
+
+// EvtnumStats tracks the queued frames of one Evtnum, and
+// optionally caps them.
+type EvtnumStats struct {
+	Count   int64 // frames currently queued
+	Bytes   int64 // payload bytes currently queued, per SizeFunc
+	Added   int64 // frames ever accepted
+	Dropped int64 // frames rejected by Add for exceeding the budget
+	Evicted int64 // queued frames evicted to make room, per pq.Evictor
+
+	MaxCount int64 // budget on Count; 0 means unlimited
+	MaxBytes int64 // budget on Bytes; 0 means unlimited
+}
+
+// EnableEvtnumStats turns on per-Evtnum accounting, starting
+// from the current contents of the queue. Accounting costs a
+// map lookup per operation, so it is off until requested.
+func (pq *PriorityQueue) EnableEvtnumStats() {
+	if pq.ByEvtnum != nil {
+		return
+	}
+	pq.ByEvtnum = make(map[tf.Evtnum]*EvtnumStats)
+	for _, pqe := range pq.Seq {
+		pq.account(pqe.Val, 1)
+	}
+}
+
+// SetEvtnumBudget caps the number of queued frames, and their
+// payload bytes, for Evtnum ev. A zero limit means unlimited.
+// Frames already queued are not evicted; the budget applies
+// to subsequent calls to Add. When a frame would exceed the
+// budget, pq.Evictor (if set) may evict queued frames of the
+// same Evtnum to make room; otherwise the new frame is rejected.
+func (pq *PriorityQueue) SetEvtnumBudget(ev tf.Evtnum, maxCount, maxBytes int64) {
+	pq.EnableEvtnumStats()
+	st := pq.evtnumStats(ev)
+	st.MaxCount = maxCount
+	st.MaxBytes = maxBytes
+}
+
+// EvtnumStatsFor returns a copy of the accounting for ev.
+// It is the zero value if accounting is off or ev was never seen.
+func (pq *PriorityQueue) EvtnumStatsFor(ev tf.Evtnum) EvtnumStats {
+	if st, ok := pq.ByEvtnum[ev]; ok {
+		return *st
+	}
+	return EvtnumStats{}
+}
+
+// admit reports whether f fits within its Evtnum budget,
+// evicting queued frames of the same Evtnum if pq.Evictor
+// chooses to, and counting a drop if f is rejected. Victims
+// are chosen against running totals and evicted only once f is
+// certain to be admitted, so a rejected frame costs nothing.
+func (pq *PriorityQueue) admit(f *tf.Frame) bool {
+	if pq.ByEvtnum == nil {
+		return true
+	}
+	ev := f.GetEvtnum()
+	st := pq.evtnumStats(ev)
+	size := pq.sizeOf(f)
+	if !overBudget(st, st.Count, st.Bytes, size) {
+		return true
+	}
+	if pq.Evictor == nil || (st.MaxBytes > 0 && size > st.MaxBytes) {
+		// no eviction could make room for it.
+		st.Dropped++
+		return false
+	}
+
+	incoming := &Pqe{Val: f, OrderBy: time.Unix(0, f.Tm()), Idx: -1, InsertSeq: pq.nextSeq}
+	cands := append(pq.entriesOf(ev), incoming)
+	var victims []*Pqe
+	sim := *st
+	for overBudget(st, sim.Count, sim.Bytes, size) {
+		v := pq.Evictor.ChooseVictim(sim, cands)
+		if v < 0 || v >= len(cands)-1 {
+			st.Dropped++
+			return false
+		}
+		victim := cands[v]
+		victims = append(victims, victim)
+		cands = append(cands[:v], cands[v+1:]...)
+		sim.Count--
+		sim.Bytes -= pq.sizeOf(victim.Val)
+	}
+	for _, victim := range victims {
+		st.Evicted++
+		pq.evict(victim, ErrEvtnumBudget.Error())
+	}
+	return true
+}
+
+// overBudget reports whether adding a frame of size bytes to
+// count frames totalling bytes would break st's budget.
+func overBudget(st *EvtnumStats, count, bytes, size int64) bool {
+	if st.MaxCount > 0 && count+1 > st.MaxCount {
+		return true
+	}
+	return st.MaxBytes > 0 && bytes+size > st.MaxBytes
+}
+
+// entriesOf returns the queued entries whose frame has Evtnum ev.
+func (pq *PriorityQueue) entriesOf(ev tf.Evtnum) []*Pqe {
+	var res []*Pqe
+	for _, pqe := range pq.Seq {
+		if pqe.Val != nil && pqe.Val.GetEvtnum() == ev {
+			res = append(res, pqe)
+		}
+	}
+	return res
+}
+
+// account adds (dir == 1) or removes (dir == -1) f from the
+// per-Evtnum totals, if accounting is on.
+func (pq *PriorityQueue) account(f *tf.Frame, dir int64) {
+	if pq.ByEvtnum == nil || f == nil {
+		return
+	}
+	st := pq.evtnumStats(f.GetEvtnum())
+	st.Count += dir
+	st.Bytes += dir * pq.sizeOf(f)
+	if dir > 0 {
+		st.Added++
+	}
+}
+
+func (pq *PriorityQueue) evtnumStats(ev tf.Evtnum) *EvtnumStats {
+	st, ok := pq.ByEvtnum[ev]
+	if !ok {
+		st = &EvtnumStats{}
+		pq.ByEvtnum[ev] = st
+	}
+	return st
+}
+
+func (pq *PriorityQueue) sizeOf(f *tf.Frame) int64 {
+	if pq.SizeFunc != nil {
+		return pq.SizeFunc(f)
+	}
+	return DefaultSizeFunc(f)
+}
@@ -0,0 +1,155 @@
+package pq
+
+import (
+	"container/heap"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+	"time"
+)
+
+func Test011EvtnumBudgetCapsOneTypeOnly(t *testing.T) {
+
+	cv.Convey("a per-Evtnum count budget should reject only frames of that Evtnum, and count the drops", t, func() {
+
+		n := 30
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		pq.SetEvtnumBudget(tf.EvZero, 3, 0)
+
+		rejected := 0
+		for i := range frames {
+			_, err := pq.Add(frames[i])
+			if err != nil {
+				cv.So(err, cv.ShouldEqual, ErrEvtnumBudget)
+				cv.So(frames[i].GetEvtnum(), cv.ShouldEqual, tf.EvZero)
+				rejected++
+			}
+		}
+		zero := pq.EvtnumStatsFor(tf.EvZero)
+		cv.So(rejected, cv.ShouldEqual, n/3-3)
+		cv.So(zero.Count, cv.ShouldEqual, int64(3))
+		cv.So(zero.Dropped, cv.ShouldEqual, int64(rejected))
+		cv.So(pq.EvtnumStatsFor(tf.EvTwo64).Count, cv.ShouldEqual, int64(n/3))
+
+		// popping frees budget.
+		for pq.First().Val.GetEvtnum() != tf.EvZero {
+			heap.Pop(pq)
+		}
+		heap.Pop(pq)
+		cv.So(pq.EvtnumStatsFor(tf.EvZero).Count, cv.ShouldEqual, int64(2))
+		_, err := pq.Add(frames[0])
+		cv.So(err, cv.ShouldBeNil)
+	})
+}
+
+func Test012EvictorMakesRoomWithinABudget(t *testing.T) {
+
+	cv.Convey("with an OldestEvictor, a capped Evtnum should keep its most recent frames", t, func() {
+
+		n := 30
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		pq.SetEvtnumBudget(tf.EvZero, 3, 0)
+		pq.Evictor = OldestEvictor{}
+
+		for i := range frames {
+			_, err := pq.Add(frames[i])
+			cv.So(err, cv.ShouldBeNil)
+		}
+		zero := pq.EvtnumStatsFor(tf.EvZero)
+		cv.So(zero.Count, cv.ShouldEqual, int64(3))
+		cv.So(zero.Evicted, cv.ShouldEqual, int64(n/3-3))
+		cv.So(zero.Dropped, cv.ShouldEqual, int64(0))
+
+		var kept []*tf.Frame
+		for pq.Len() > 0 {
+			pqe := heap.Pop(pq).(*Pqe)
+			if pqe.Val.GetEvtnum() == tf.EvZero {
+				kept = append(kept, pqe.Val)
+			}
+		}
+		cv.So(kept, cv.ShouldResemble, []*tf.Frame{frames[22], frames[25], frames[28]})
+	})
+
+	cv.Convey("a NewestEvictor should reject in-order arrivals, like having no Evictor", t, func() {
+
+		frames, _, _ := GenTestFrames(30, nil)
+		pq := NewPriorityQueue()
+		pq.SetEvtnumBudget(tf.EvZero, 3, 0)
+		pq.Evictor = NewestEvictor{}
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		cv.So(pq.EvtnumStatsFor(tf.EvZero).Dropped, cv.ShouldEqual, int64(7))
+		cv.So(pq.EvtnumStatsFor(tf.EvZero).Evicted, cv.ShouldEqual, int64(0))
+	})
+}
+
+func Test051OversizedFrameEvictsNothing(t *testing.T) {
+
+	t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+	mk := func(sec int, size int) *tf.Frame {
+		f, err := tf.NewFrame(t0.Add(time.Duration(sec)*time.Second), tf.EvMsgpKafka, 0, 0, make([]byte, size))
+		panicOn(err)
+		return f
+	}
+
+	cv.Convey("a frame bigger than its whole byte budget should be rejected without evicting anything", t, func() {
+
+		pq := NewPriorityQueue()
+		pq.SizeFunc = func(f *tf.Frame) int64 { return int64(len(f.Data)) }
+		pq.SetEvtnumBudget(tf.EvMsgpKafka, 0, 100)
+		pq.Evictor = OldestEvictor{}
+		for i := 0; i < 5; i++ {
+			_, err := pq.Add(mk(i, 20))
+			cv.So(err, cv.ShouldBeNil)
+		}
+		_, err := pq.Add(mk(5, 150))
+		cv.So(err, cv.ShouldEqual, ErrEvtnumBudget)
+		cv.So(pq.Len(), cv.ShouldEqual, 5)
+		st := pq.EvtnumStatsFor(tf.EvMsgpKafka)
+		cv.So(st.Evicted, cv.ShouldEqual, int64(0))
+		cv.So(st.Dropped, cv.ShouldEqual, int64(1))
+	})
+
+	cv.Convey("a frame that fits once enough is evicted should evict just enough", t, func() {
+
+		pq := NewPriorityQueue()
+		pq.SizeFunc = func(f *tf.Frame) int64 { return int64(len(f.Data)) }
+		pq.SetEvtnumBudget(tf.EvMsgpKafka, 0, 100)
+		pq.Evictor = OldestEvictor{}
+		for i := 0; i < 5; i++ {
+			pq.Add(mk(i, 20))
+		}
+		_, err := pq.Add(mk(5, 50))
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(pq.Len(), cv.ShouldEqual, 3)
+		st := pq.EvtnumStatsFor(tf.EvMsgpKafka)
+		cv.So(st.Evicted, cv.ShouldEqual, int64(3))
+		cv.So(st.Bytes, cv.ShouldEqual, int64(90))
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+	})
+
+	cv.Convey("if the Evictor gives up part way, nothing should have been evicted", t, func() {
+
+		pq := NewPriorityQueue()
+		pq.SizeFunc = func(f *tf.Frame) int64 { return int64(len(f.Data)) }
+		pq.SetEvtnumBudget(tf.EvMsgpKafka, 0, 100)
+		calls := 0
+		pq.Evictor = EvictorFunc(func(b Budget, cands []*Pqe) int {
+			calls++
+			if calls > 1 {
+				return -1
+			}
+			return 0
+		})
+		for i := 0; i < 5; i++ {
+			pq.Add(mk(i, 20))
+		}
+		_, err := pq.Add(mk(5, 50))
+		cv.So(err, cv.ShouldEqual, ErrEvtnumBudget)
+		cv.So(pq.Len(), cv.ShouldEqual, 5)
+		cv.So(pq.EvtnumStatsFor(tf.EvMsgpKafka).Evicted, cv.ShouldEqual, int64(0))
+	})
+}
@@ -0,0 +1,122 @@
+package pq
+
+import (
+	"bytes"
+	"fmt"
+	tf "github.com/glycerine/tmframe"
+	"time"
+)
+
+var exampleT0 = time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+
+// frameAt returns a frame sec seconds after exampleT0 carrying v.
+func frameAt(sec int, v float64) *tf.Frame {
+	f, err := tf.NewFrame(exampleT0.Add(time.Duration(sec)*time.Second), tf.EvOneFloat64, v, 0, nil)
+	panicOn(err)
+	return f
+}
+
+// secOf returns f's timestamp as seconds after exampleT0.
+func secOf(f *tf.Frame) int64 {
+	return (f.Tm() - exampleT0.UnixNano()) / int64(time.Second)
+}
+
+// Merge two recorded tmframe files into one time-sorted file.
+func Example_merge() {
+	var a, b bytes.Buffer
+	for sec := 0; sec < 10; sec++ {
+		by, err := frameAt(sec, 0).Marshal(nil)
+		panicOn(err)
+		if sec%3 == 0 {
+			a.Write(by)
+		} else {
+			b.Write(by)
+		}
+	}
+
+	var merged bytes.Buffer
+	if err := Merge(&merged, &a, &b); err != nil {
+		fmt.Println(err)
+		return
+	}
+	for f, err := range ReadFrames(&merged) {
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Print(secOf(f), " ")
+	}
+	fmt.Println()
+	// Output:
+	// 0 1 2 3 4 5 6 7 8 9
+}
+
+// Put a jittery feed, such as frames arriving over UDP, back in
+// order, holding each frame back at most three seconds of
+// event time.
+func Example_reorder() {
+	arrivals := []int{0, 2, 1, 3, 6, 4, 5, 9, 7, 8}
+
+	r := NewReorderer(3 * time.Second)
+	r.EventTime = true
+	for _, sec := range arrivals {
+		if err := r.Add(frameAt(sec, 0)); err != nil {
+			fmt.Println(err)
+		}
+		for _, f := range r.Release() {
+			fmt.Print(secOf(f), " ")
+		}
+	}
+	for _, f := range r.Flush() {
+		fmt.Print(secOf(f), " ")
+	}
+	fmt.Println()
+	// Output:
+	// 0 1 2 3 4 5 6 7 8 9
+}
+
+// Keep the last few frames in a ring, and when an anomaly
+// arrives dump them as the context leading up to it.
+func Example_flightRecorder() {
+	ring := NewFrameRingBuf(4)
+	for sec := 0; sec < 20; sec++ {
+		v := float64(sec % 7)
+		f := frameAt(sec, v)
+		if v == 6 {
+			fmt.Printf("anomaly at %d; before it:", sec)
+			for g := range ring.All() {
+				fmt.Print(" ", secOf(g))
+			}
+			fmt.Println()
+		}
+		ring.WriteOverwrite([]*tf.Frame{f})
+	}
+	// Output:
+	// anomaly at 6; before it: 2 3 4 5
+	// anomaly at 13; before it: 9 10 11 12
+}
+
+// Replay a recorded file at ten times realtime, as when
+// backtesting a consumer against recorded data.
+func Example_replay() {
+	var file bytes.Buffer
+	for _, sec := range []int{0, 2, 1, 3} {
+		by, err := frameAt(sec, 0).Marshal(nil)
+		panicOn(err)
+		file.Write(by)
+	}
+
+	out := make(chan *tf.Frame)
+	go Replay(&file, 10, out)
+	start := time.Now()
+	var got []int64
+	for f := range out {
+		got = append(got, secOf(f))
+	}
+	fmt.Println(got)
+	// three seconds of data at 10x take 300ms.
+	fmt.Println(time.Since(start) >= 300*time.Millisecond)
+	// Output:
+	// [0 1 2 3]
+	// true
+}
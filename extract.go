@@ -0,0 +1,50 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"time"
+)
+
+// Extract returns a FrameSource streaming only the frames of
+// src whose timestamps fall within [from, to): the file-source
+// counterpart of PriorityQueue.Extract. Frames before from are
+// read and skipped, since a plain tmframe stream has no index to
+// seek by; at the first frame at or after to, the stream ends
+// with io.EOF without reading further, so pulling a few minutes
+// from early in a long capture reads little of it. For a
+// day-partitioned archive, NewArchiveSource already skips whole
+// days outside the range.
+//
+//	f, _ := os.Open("capture.tf")
+//	for fr, err := range pq.Frames(pq.Extract(pq.NewReaderSource(f), from, to)) { ... }
+func Extract(src FrameSource, from, to time.Time) FrameSource {
+	return &rangeSource{src: src, from: from.UnixNano(), to: to.UnixNano()}
+}
+
+// rangeSource yields the frames of src in [from, to).
+type rangeSource struct {
+	src      FrameSource
+	from, to int64
+	done     bool
+}
+
+func (s *rangeSource) NextFrame() (*tf.Frame, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	for {
+		f, err := s.src.NextFrame()
+		if err != nil {
+			return nil, err
+		}
+		if f.Tm() < s.from {
+			continue
+		}
+		if f.Tm() >= s.to {
+			s.done = true
+			return nil, io.EOF
+		}
+		return f, nil
+	}
+}
@@ -0,0 +1,65 @@
+package pq
+
+import (
+	"bytes"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"testing"
+	"time"
+)
+
+// countingSource counts the frames read from src.
+type countingSource struct {
+	src   FrameSource
+	reads int
+}
+
+func (c *countingSource) NextFrame() (*tf.Frame, error) {
+	c.reads++
+	return c.src.NextFrame()
+}
+
+func Test067ExtractStreamsATimeRange(t *testing.T) {
+
+	t0 := time.Date(2016, 2, 16, 14, 0, 0, 0, time.UTC)
+	var frames []*tf.Frame
+	for s := 0; s < 100; s++ {
+		f, err := tf.NewFrame(t0.Add(time.Duration(s)*time.Second), tf.EvTwo64, 0, int64(s), nil)
+		panicOn(err)
+		frames = append(frames, f)
+	}
+
+	cv.Convey("Extract over a marshalled stream should yield just the frames in [from, to)", t, func() {
+
+		var by []byte
+		for _, f := range frames {
+			b, err := f.Marshal(nil)
+			panicOn(err)
+			by = append(by, b...)
+		}
+		src := Extract(NewReaderSource(bytes.NewReader(by)), t0.Add(10*time.Second), t0.Add(15*time.Second))
+		var got []int64
+		for f, err := range Frames(src) {
+			cv.So(err, cv.ShouldBeNil)
+			got = append(got, f.GetV1())
+		}
+		cv.So(got, cv.ShouldResemble, []int64{10, 11, 12, 13, 14})
+	})
+
+	cv.Convey("Extract should stop reading its source at the first frame past the range", t, func() {
+
+		c := &countingSource{src: &sliceSource{frames: frames}}
+		src := Extract(c, t0.Add(10*time.Second), t0.Add(15*time.Second))
+		n := 0
+		for range Frames(src) {
+			n++
+		}
+		cv.So(n, cv.ShouldEqual, 5)
+		cv.So(c.reads, cv.ShouldEqual, 16)
+
+		_, err := src.NextFrame()
+		cv.So(err, cv.ShouldEqual, io.EOF)
+		cv.So(c.reads, cv.ShouldEqual, 16)
+	})
+}
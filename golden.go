@@ -0,0 +1,51 @@
+package pq
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// VerifyGolden checks that r holds a snapshot in exactly the
+// canonical form Marshal writes: a well-formed header with a
+// known Policy, exactly Count frames in pop order, and nothing
+// after them. It loads the snapshot and marshals it again, and
+// reports the first byte at which the two differ. It reads r
+// fully into memory, being meant for test vectors, such as the
+// corpus under testdata/golden that other implementations of
+// the format can be checked against.
+func VerifyGolden(r io.Reader) error {
+	in, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	br := bytes.NewReader(in)
+	pq, err := LoadPriorityQueue(br)
+	if err != nil {
+		return err
+	}
+	if br.Len() > 0 {
+		return fmt.Errorf("pq: golden: %d bytes after the last frame", br.Len())
+	}
+	if pq.MaxLen < 0 {
+		return fmt.Errorf("pq: golden: negative MaxLen %d", pq.MaxLen)
+	}
+	switch pq.Policy {
+	case RejectNewest, EvictEarliest, EvictLatest, EvictByEvictor:
+	default:
+		return fmt.Errorf("pq: golden: unknown Policy %d", int(pq.Policy))
+	}
+	var out bytes.Buffer
+	if err := pq.Marshal(&out); err != nil {
+		return err
+	}
+	if !bytes.Equal(in, out.Bytes()) {
+		i := 0
+		for i < len(in) && i < out.Len() && in[i] == out.Bytes()[i] {
+			i++
+		}
+		return fmt.Errorf("pq: golden: not canonical; differs from the re-encoding at byte %d", i)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package pq
+
+import (
+	"bytes"
+	"flag"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the frame-bearing golden vectors in testdata/golden")
+
+// goldenFrames returns a fixed queue covering each frame shape
+// and a timestamp tie, for the frame-bearing golden vectors.
+func goldenFrames() *PriorityQueue {
+	t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+	mk := func(sec int, ev tf.Evtnum, v0 float64, v1 int64, data []byte) *tf.Frame {
+		f, err := tf.NewFrame(t0.Add(time.Duration(sec)*time.Second), ev, v0, v1, data)
+		panicOn(err)
+		return f
+	}
+	pq := NewBoundedPriorityQueue(64, EvictEarliest)
+	for _, f := range []*tf.Frame{
+		mk(3, tf.EvTwo64, 1.5, -7, nil),
+		mk(1, tf.EvZero, 0, 0, nil),
+		mk(2, tf.EvOneFloat64, 2.25, 0, nil),
+		mk(2, tf.EvMsgpKafka, 0, 0, []byte("golden")),
+	} {
+		_, err := pq.Add(f)
+		panicOn(err)
+	}
+	return pq
+}
+
+func Test058GoldenSnapshotVectors(t *testing.T) {
+
+	if *updateGolden {
+		var buf bytes.Buffer
+		panicOn(goldenFrames().Marshal(&buf))
+		panicOn(ioutil.WriteFile(filepath.Join("testdata", "golden", "ok-frames-mixed.pqsnap"), buf.Bytes(), 0644))
+	}
+
+	cv.Convey("every ok-* golden vector should verify, and every bad-* one should not", t, func() {
+
+		paths, err := filepath.Glob(filepath.Join("testdata", "golden", "*.pqsnap"))
+		panicOn(err)
+		cv.So(len(paths), cv.ShouldBeGreaterThan, 0)
+		for _, path := range paths {
+			f, err := os.Open(path)
+			panicOn(err)
+			err = VerifyGolden(f)
+			f.Close()
+			if strings.HasPrefix(filepath.Base(path), "ok-") {
+				cv.So(err, cv.ShouldBeNil)
+			} else {
+				cv.So(err, cv.ShouldNotBeNil)
+			}
+		}
+	})
+
+	cv.Convey("a snapshot from Marshal should verify, and one altered after the fact should not", t, func() {
+
+		var buf bytes.Buffer
+		panicOn(goldenFrames().Marshal(&buf))
+		good := buf.Bytes()
+		cv.So(VerifyGolden(bytes.NewReader(good)), cv.ShouldBeNil)
+
+		cv.So(VerifyGolden(bytes.NewReader(append(append([]byte(nil), good...), 0))), cv.ShouldNotBeNil)
+		cv.So(VerifyGolden(bytes.NewReader(good[:len(good)-1])), cv.ShouldNotBeNil)
+
+		// frames out of pop order are not canonical.
+		pq := NewPriorityQueue()
+		var frames []*tf.Frame
+		for f := range goldenFrames().Drain() {
+			frames = append(frames, f)
+		}
+		var swapped bytes.Buffer
+		panicOn(pq.Marshal(&swapped))
+		hdr := swapped.Bytes()
+		hdr[8] = byte(len(frames))
+		out := append([]byte(nil), hdr...)
+		for i := len(frames) - 1; i >= 0; i-- {
+			b, err := frames[i].Marshal(nil)
+			panicOn(err)
+			out = append(out, b...)
+		}
+		cv.So(VerifyGolden(bytes.NewReader(out)), cv.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,87 @@
+package pq
+
+import (
+	"sort"
+	"time"
+)
+
+// EnableRangeIndex keeps a secondary index of the queued
+// entries in time order, so that Range, Extract and
+// ExtractBounds binary-search their window rather than walk
+// the heap. Without it they still prune subtrees rooted past
+// the end of the window, but must visit every earlier entry.
+// Once on, every Add, Push, Pop, Update and eviction also
+// updates the index: O(log n) to find the place, plus a copy
+// of the index entries after it.
+func (pq *PriorityQueue) EnableRangeIndex() {
+	if pq.byTime != nil {
+		return
+	}
+	pq.byTime = make([]*Pqe, len(pq.Seq))
+	copy(pq.byTime, pq.Seq)
+	sort.Sort(pqeByTime(pq.byTime))
+}
+
+// Range returns, in time order, the live entries whose OrderBy
+// falls within [from, to), without disturbing the heap, e.g. to
+// answer what pending data covers 09:30-09:31. It writes
+// nothing, so it is safe under a read lock. Call
+// EnableRangeIndex first if Range is frequent and the queue
+// long. Do not modify the returned entries except through
+// Update.
+func (pq *PriorityQueue) Range(from, to time.Time) []*Pqe {
+	if !from.Before(to) {
+		return nil
+	}
+	return pq.entriesWithin(from, Inclusive, to, Exclusive)
+}
+
+// indexWithin is entriesWithin using the time index.
+func (pq *PriorityQueue) indexWithin(from time.Time, fromB Bound, to time.Time, toB Bound) []*Pqe {
+	idx := pq.byTime
+	lo := sort.Search(len(idx), func(i int) bool {
+		t := idx[i].OrderBy
+		return t.After(from) || (fromB == Inclusive && t.Equal(from))
+	})
+	hi := sort.Search(len(idx), func(i int) bool {
+		t := idx[i].OrderBy
+		return t.After(to) || (toB == Exclusive && t.Equal(to))
+	})
+	if lo >= hi {
+		return nil
+	}
+	return append([]*Pqe(nil), idx[lo:hi]...)
+}
+
+// indexTrack adds pqe to the time index, if there is one.
+func (pq *PriorityQueue) indexTrack(pqe *Pqe) {
+	if pq.byTime == nil {
+		return
+	}
+	i := pq.indexSearch(pqe)
+	pq.byTime = append(pq.byTime, nil)
+	copy(pq.byTime[i+1:], pq.byTime[i:])
+	pq.byTime[i] = pqe
+}
+
+// indexForget removes pqe from the time index.
+func (pq *PriorityQueue) indexForget(pqe *Pqe) {
+	if pq.byTime == nil {
+		return
+	}
+	i := pq.indexSearch(pqe)
+	n := len(pq.byTime) - 1
+	if i > n || pq.byTime[i] != pqe {
+		return
+	}
+	copy(pq.byTime[i:], pq.byTime[i+1:])
+	pq.byTime[n] = nil
+	pq.byTime = pq.byTime[:n]
+}
+
+// indexSearch returns the position of pqe in the time index,
+// or the position it would be inserted at.
+func (pq *PriorityQueue) indexSearch(pqe *Pqe) int {
+	idx := pq.byTime
+	return sort.Search(len(idx), func(i int) bool { return !earlier(idx[i], pqe) })
+}
@@ -0,0 +1,68 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"iter"
+)
+
+// Frames adapts a FrameSource to a range-over-func iterator.
+// Iteration stops at io.EOF; any other error is yielded once,
+// with a nil frame, and ends the iteration.
+//
+//	for f, err := range pq.Frames(src) { ... }
+func Frames(src FrameSource) iter.Seq2[*tf.Frame, error] {
+	return func(yield func(*tf.Frame, error) bool) {
+		for {
+			f, err := src.NextFrame()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// ReadFrames iterates over the marshalled tmframe stream in r.
+func ReadFrames(r io.Reader) iter.Seq2[*tf.Frame, error] {
+	return Frames(NewReaderSource(r))
+}
+
+// Drain returns an iterator that pops frames from the queue
+// in order until it is empty. Breaking out of the loop leaves
+// the remaining frames queued.
+func (pq *PriorityQueue) Drain() iter.Seq[*tf.Frame] {
+	return func(yield func(*tf.Frame) bool) {
+		for {
+			f, ok := pq.PopFrame()
+			if !ok || !yield(f) {
+				return
+			}
+		}
+	}
+}
+
+// All iterates over the readable elements of the ring, oldest
+// first, without consuming them. The ring must not be written
+// to during the iteration.
+func (b *RingBuf[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		first, second := b.TwoContig(false)
+		for _, x := range first {
+			if !yield(x) {
+				return
+			}
+		}
+		for _, x := range second {
+			if !yield(x) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package pq
+
+import (
+	"bytes"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+)
+
+func Test024IteratorAdapters(t *testing.T) {
+
+	cv.Convey("the iter.Seq adapters should compose reader, queue, and ring without bespoke loops", t, func() {
+
+		n := 25
+		frames, _, by := GenTestFrames(n, nil)
+
+		pq := NewPriorityQueue()
+		for f, err := range ReadFrames(bytes.NewReader(by)) {
+			cv.So(err, cv.ShouldBeNil)
+			pq.Add(f)
+		}
+		cv.So(pq.Len(), cv.ShouldEqual, n)
+
+		ring := NewFrameRingBuf(10)
+		for f := range pq.Drain() {
+			ring.WriteOverwrite([]*tf.Frame{f})
+			if ring.Readable == 10 {
+				break
+			}
+		}
+		cv.So(pq.Len(), cv.ShouldEqual, n-10)
+
+		i := 0
+		for f := range ring.All() {
+			cv.So(f.Tm(), cv.ShouldEqual, frames[i].Tm())
+			i++
+		}
+		cv.So(i, cv.ShouldEqual, 10)
+	})
+}
@@ -0,0 +1,124 @@
+package pq
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// JournalOp names the kind of queue operation a JournalEntry records.
+type JournalOp int
+
+const (
+	JournalAdd JournalOp = iota
+	JournalPop
+	JournalUpdate
+	JournalReject
+	JournalEvict
+)
+
+func (op JournalOp) String() string {
+	switch op {
+	case JournalAdd:
+		return "add"
+	case JournalPop:
+		return "pop"
+	case JournalUpdate:
+		return "update"
+	case JournalReject:
+		return "reject"
+	case JournalEvict:
+		return "evict"
+	}
+	return fmt.Sprintf("JournalOp(%d)", int(op))
+}
+
+// JournalEntry is one recorded queue operation.
+type JournalEntry struct {
+	Op      JournalOp
+	When    time.Time // wall clock time of the operation
+	FrameTm time.Time // OrderBy of the frame involved
+	Reason  string
+}
+
+// Journal is a fixed-size circular log of the most recent
+// queue operations, a flight recorder for the queue itself.
+// Once full, each new entry overwrites the oldest.
+//
+// Set PriorityQueue.Journal to a Journal to start recording;
+// a nil Journal records nothing.
+type Journal struct {
+	A        []JournalEntry
+	N        int // the total size of A
+	Beg      int // start of in-use entries in A
+	Readable int // number of entries in use
+}
+
+// NewJournal returns a Journal remembering the last n operations.
+func NewJournal(n int) *Journal {
+	if n < 1 {
+		n = 1
+	}
+	return &Journal{
+		A: make([]JournalEntry, n),
+		N: n,
+	}
+}
+
+// Record appends an entry for op, overwriting the oldest entry if the
+// journal is full. Record on a nil Journal is a no-op.
+func (j *Journal) Record(op JournalOp, frameTm time.Time, reason string) {
+	if j == nil {
+		return
+	}
+	e := JournalEntry{
+		Op:      op,
+		When:    time.Now(),
+		FrameTm: frameTm,
+		Reason:  reason,
+	}
+	if j.Readable < j.N {
+		j.A[(j.Beg+j.Readable)%j.N] = e
+		j.Readable++
+		return
+	}
+	j.A[j.Beg] = e
+	j.Beg = (j.Beg + 1) % j.N
+}
+
+// Entries returns a copy of the recorded entries, oldest first.
+func (j *Journal) Entries() []JournalEntry {
+	if j == nil {
+		return nil
+	}
+	res := make([]JournalEntry, j.Readable)
+	for i := 0; i < j.Readable; i++ {
+		res[i] = j.A[(j.Beg+i)%j.N]
+	}
+	return res
+}
+
+// Dump writes the recorded entries to w, oldest first, one per line.
+func (j *Journal) Dump(w io.Writer) error {
+	for _, e := range j.Entries() {
+		_, err := fmt.Fprintf(w, "%s %-6s frame=%s %s\n",
+			e.When.Format(time.RFC3339Nano), e.Op,
+			e.FrameTm.UTC().Format(time.RFC3339Nano), e.Reason)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DumpOnPanic is meant to be deferred: if the surrounding
+// function is panicking, it dumps the journal to w and
+// then re-panics with the original value.
+//
+//	defer pq.Journal.DumpOnPanic(os.Stderr)
+func (j *Journal) DumpOnPanic(w io.Writer) {
+	if r := recover(); r != nil {
+		j.Dump(w)
+		panic(r)
+	}
+}
@@ -0,0 +1,39 @@
+package pq
+
+import (
+	"bytes"
+	"container/heap"
+	cv "github.com/glycerine/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func Test007JournalKeepsTheLastNOperations(t *testing.T) {
+
+	cv.Convey("a queue's Journal should keep only the most recent operations, oldest first", t, func() {
+
+		frames, _, _ := GenTestFrames(10, nil)
+		pq := NewPriorityQueue()
+		pq.Journal = NewJournal(4)
+
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		heap.Pop(pq)
+		stale := pq.First()
+		gen := stale.Gen
+		heap.Pop(pq)
+		pq.UpdateIfCurrent(stale, gen, frames[0])
+
+		ents := pq.Journal.Entries()
+		cv.So(len(ents), cv.ShouldEqual, 4)
+		cv.So(ents[0].Op, cv.ShouldEqual, JournalAdd)
+		cv.So(ents[1].Op, cv.ShouldEqual, JournalPop)
+		cv.So(ents[2].Op, cv.ShouldEqual, JournalPop)
+		cv.So(ents[3].Op, cv.ShouldEqual, JournalReject)
+
+		var buf bytes.Buffer
+		cv.So(pq.Journal.Dump(&buf), cv.ShouldBeNil)
+		cv.So(strings.Count(buf.String(), "\n"), cv.ShouldEqual, 4)
+	})
+}
@@ -0,0 +1,99 @@
+package pq
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LatenessEstimator learns how much lateness a Reorderer needs
+// from the frames themselves, instead of a hand-tuned constant.
+// For each source it keeps the last Window observations of how
+// far behind the clock a frame arrived, and estimates the
+// lateness as the Quantile of those, plus Margin. The slowest
+// source sets the estimate, since the watermark must wait for
+// it. Give a Reorderer one in its Adaptive field.
+//
+// A LatenessEstimator is not safe for concurrent use.
+type LatenessEstimator struct {
+	Window   int
+	Quantile float64
+	Margin   time.Duration
+
+	sources map[int]*lateWindow
+}
+
+// lateWindow is one source's sliding window of observations.
+type lateWindow struct {
+	obs   []time.Duration
+	next  int // where the next observation goes, once obs is full
+	est   time.Duration
+	dirty bool // est is out of date
+}
+
+// NewLatenessEstimator returns an estimator keeping window
+// observations per source and covering the quantile of them,
+// for example 0.999, plus margin. A window below 1 is taken as
+// 1, and quantile is clamped to [0, 1].
+func NewLatenessEstimator(window int, quantile float64, margin time.Duration) *LatenessEstimator {
+	if window < 1 {
+		window = 1
+	}
+	return &LatenessEstimator{
+		Window:   window,
+		Quantile: math.Max(0, math.Min(1, quantile)),
+		Margin:   margin,
+		sources:  make(map[int]*lateWindow),
+	}
+}
+
+// Observe records that a frame from src arrived late behind
+// the clock. A frame ahead of the clock counts as 0.
+func (e *LatenessEstimator) Observe(src int, late time.Duration) {
+	if late < 0 {
+		late = 0
+	}
+	w := e.sources[src]
+	if w == nil {
+		w = &lateWindow{}
+		e.sources[src] = w
+	}
+	if len(w.obs) < e.Window {
+		w.obs = append(w.obs, late)
+	} else {
+		w.obs[w.next] = late
+		w.next = (w.next + 1) % len(w.obs)
+	}
+	w.dirty = true
+}
+
+// Lateness returns the current estimate, and false if nothing
+// has been observed yet.
+func (e *LatenessEstimator) Lateness() (time.Duration, bool) {
+	if len(e.sources) == 0 {
+		return 0, false
+	}
+	var worst time.Duration
+	for _, w := range e.sources {
+		if w.dirty {
+			w.est = quantileOf(w.obs, e.Quantile)
+			w.dirty = false
+		}
+		if w.est > worst {
+			worst = w.est
+		}
+	}
+	return worst + e.Margin, true
+}
+
+// quantileOf returns the nearest-rank q quantile of obs, which
+// must not be empty.
+func quantileOf(obs []time.Duration, q float64) time.Duration {
+	s := append([]time.Duration(nil), obs...)
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	i := int(math.Ceil(q*float64(len(s)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return s[i]
+}
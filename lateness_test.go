@@ -0,0 +1,54 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+	"time"
+)
+
+func Test063AdaptiveLateness(t *testing.T) {
+
+	cv.Convey("a LatenessEstimator should cover the quantile of the slowest source over its window, plus the margin", t, func() {
+
+		e := NewLatenessEstimator(1000, 0.999, 100*time.Millisecond)
+		_, ok := e.Lateness()
+		cv.So(ok, cv.ShouldBeFalse)
+
+		for i := 1; i <= 1000; i++ {
+			e.Observe(0, time.Duration(i)*time.Millisecond)
+			e.Observe(1, -time.Second)
+		}
+		d, ok := e.Lateness()
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(d, cv.ShouldEqual, 999*time.Millisecond+100*time.Millisecond)
+
+		// old observations slide out of the window.
+		for i := 0; i < 1000; i++ {
+			e.Observe(0, 10*time.Millisecond)
+		}
+		d, _ = e.Lateness()
+		cv.So(d, cv.ShouldEqual, 110*time.Millisecond)
+	})
+
+	cv.Convey("a Reorderer with an Adaptive estimator should set its watermark from how late frames actually arrive", t, func() {
+
+		t0 := time.Date(2016, 2, 15, 0, 0, 0, 0, time.UTC)
+		at := func(s int) *tf.Frame {
+			f, err := tf.NewFrame(t0.Add(time.Duration(s)*time.Second), tf.EvTwo64, 0, int64(s), nil)
+			panicOn(err)
+			return f
+		}
+		r := NewReorderer(time.Hour)
+		r.EventTime = true
+		r.Adaptive = NewLatenessEstimator(4, 1, time.Second)
+
+		// source 1 runs three seconds behind source 0.
+		for s := 10; s < 14; s++ {
+			cv.So(r.AddFrom(0, at(s)), cv.ShouldBeNil)
+			cv.So(r.AddFrom(1, at(s-3)), cv.ShouldBeNil)
+		}
+		cv.So(r.Watermark().Equal(t0.Add(13*time.Second-3*time.Second-time.Second)), cv.ShouldBeTrue)
+		cv.So(r.Release(), cv.ShouldHaveLength, 2)
+	})
+}
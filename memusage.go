@@ -0,0 +1,81 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"unsafe"
+)
+
+// MemReport breaks down the estimated bytes held by a queue or ring.
+type MemReport struct {
+	Backing int64 // backing array(s), at capacity
+	Entries int64 // Pqe structs (queues only)
+	Frames  int64 // tf.Frame structs
+	Payload int64 // frame payload bytes, as measured by the SizeFunc
+	Total   int64
+}
+
+// SizeFunc measures the payload bytes owned by a frame,
+// beyond the fixed size of the tf.Frame struct itself.
+type SizeFunc func(f *tf.Frame) int64
+
+// DefaultSizeFunc counts the capacity of the frame's Data slice.
+func DefaultSizeFunc(f *tf.Frame) int64 {
+	return int64(cap(f.Data))
+}
+
+const (
+	ptrBytes   = int64(unsafe.Sizeof(uintptr(0)))
+	pqeBytes   = int64(unsafe.Sizeof(Pqe{}))
+	frameBytes = int64(unsafe.Sizeof(tf.Frame{}))
+)
+
+// MemUsage estimates the bytes held by the queue, using
+// pq.SizeFunc (or DefaultSizeFunc if nil) for frame payloads.
+// Frames are assumed not to be shared between entries.
+func (pq *PriorityQueue) MemUsage() MemReport {
+	size := pq.SizeFunc
+	if size == nil {
+		size = DefaultSizeFunc
+	}
+	var r MemReport
+	r.Backing = int64(cap(pq.Seq)) * ptrBytes
+	r.Entries = int64(len(pq.Seq)) * pqeBytes
+	for _, pqe := range pq.Seq {
+		if pqe.Val != nil {
+			r.Frames += frameBytes
+			r.Payload += size(pqe.Val)
+		}
+	}
+	r.Total = r.Backing + r.Entries + r.Frames + r.Payload
+	return r
+}
+
+// MemUsage estimates the bytes held by the ring, counting
+// only the elements that are currently readable. Payloads are
+// measured by b.SizeFunc; if that is nil, *tf.Frame elements
+// fall back to DefaultSizeFunc and other types count no payload.
+func (b *RingBuf[T]) MemUsage() MemReport {
+	var zero T
+	var r MemReport
+	r.Backing = int64(cap(b.A)) * int64(unsafe.Sizeof(zero))
+	first, second := b.TwoContig(false)
+	for _, part := range [][]T{first, second} {
+		for _, x := range part {
+			f, isFrame := any(x).(*tf.Frame)
+			if isFrame && f == nil {
+				continue
+			}
+			if isFrame {
+				r.Frames += frameBytes
+			}
+			switch {
+			case b.SizeFunc != nil:
+				r.Payload += b.SizeFunc(x)
+			case isFrame:
+				r.Payload += DefaultSizeFunc(f)
+			}
+		}
+	}
+	r.Total = r.Backing + r.Frames + r.Payload
+	return r
+}
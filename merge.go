@@ -0,0 +1,338 @@
+package pq
+
+import (
+	"bytes"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"slices"
+	"time"
+)
+
+// FrameSource yields frames in non-decreasing timestamp order.
+// NextFrame returns io.EOF once the source is exhausted.
+// Each returned frame must be a distinct allocation, since
+// callers may hold on to it.
+type FrameSource interface {
+	NextFrame() (*tf.Frame, error)
+}
+
+// readerSource decodes marshalled frames from an io.Reader.
+type readerSource struct {
+	fr *tf.FrameReader
+}
+
+// NewReaderSource returns a FrameSource decoding the tmframe stream in r.
+func NewReaderSource(r io.Reader) FrameSource {
+	return &readerSource{fr: tf.NewFrameReader(r, DefaultMaxFrameBytes)}
+}
+
+func (s *readerSource) NextFrame() (*tf.Frame, error) {
+	var frame tf.Frame
+	_, _, err, _ := s.fr.NextFrame(&frame)
+	if err != nil {
+		return nil, err
+	}
+	return &frame, nil
+}
+
+// chanSource receives frames from a channel until it is closed.
+type chanSource struct {
+	ch <-chan *tf.Frame
+}
+
+// NewChanSource returns a FrameSource reading from ch; it
+// reports io.EOF once ch is closed and drained.
+func NewChanSource(ch <-chan *tf.Frame) FrameSource {
+	return &chanSource{ch: ch}
+}
+
+func (s *chanSource) NextFrame() (*tf.Frame, error) {
+	f, ok := <-s.ch
+	if !ok {
+		return nil, io.EOF
+	}
+	return f, nil
+}
+
+// Merger performs a k-way merge of already time-sorted
+// FrameSources into one time-sorted stream. The queue holds
+// at most one frame per source: the current head of each.
+// A Merger is itself a FrameSource.
+//
+// If Key is set, frames from different sources with the same
+// timestamp and key are taken to be copies of one record and
+// only one is passed on: the copy from an authoritative source
+// (see SetAuthoritative) if there is one, else the copy that
+// was merged first. This lets a corrected historical feed
+// override a raw live feed covering the same span.
+//
+// For inputs that overlap at the edges, such as archive files
+// each repeating the end of the previous one, see SetOverlap.
+type Merger struct {
+	// Key, if non-nil, identifies records for de-duplication
+	// across sources. Set it before the first NextFrame.
+	Key func(f *tf.Frame) string
+
+	// Overlaps counts the frames SetOverlap's mode dropped.
+	Overlaps int64
+
+	srcs    []FrameSource
+	pq      *PriorityQueue
+	from    map[*Pqe]int // which source each queued head came from
+	stale   []int        // sources whose next head is not yet queued
+	auth    map[int]bool
+	pending []merged // de-duplicated frames not yet returned
+
+	window time.Duration
+	same   func(a, b *tf.Frame) bool
+	recent []recentFrame // frames passed on within window of the latest
+}
+
+// merged is a frame and the index of the source it came from.
+type merged struct {
+	f   *tf.Frame
+	src int
+}
+
+// recentFrame is a frame passed on in overlap mode, and the
+// sources whose copies of it have been dropped.
+type recentFrame struct {
+	merged
+	matched []int
+}
+
+// NewMerger returns a Merger over srcs.
+func NewMerger(srcs ...FrameSource) *Merger {
+	stale := make([]int, len(srcs))
+	for i := range stale {
+		stale[i] = i
+	}
+	return &Merger{
+		srcs:  srcs,
+		pq:    NewPriorityQueue(),
+		from:  make(map[*Pqe]int),
+		stale: stale,
+		auth:  make(map[int]bool),
+	}
+}
+
+// SetAuthoritative marks srcs[i] as authoritative: when Key
+// is set, its copy of a record wins over copies from other
+// sources, whatever order they arrive in.
+func (m *Merger) SetAuthoritative(i int) {
+	m.auth[i] = true
+}
+
+// SetOverlap turns on overlap mode, for inputs that repeat each
+// other's frames where they meet. A frame is dropped, and
+// counted in Overlaps, if a frame from a different source that
+// same reports equal to it was passed on at most window earlier;
+// each frame passed on stands for at most one such copy per
+// source, so repeats within one source are kept. Only frames
+// within window of the latest are remembered, so memory is
+// bounded by the overlap, not the input. If same is nil,
+// SameContent is used; with a window of 0, copies must share a
+// timestamp exactly. Set it before the first NextFrame.
+func (m *Merger) SetOverlap(window time.Duration, same func(a, b *tf.Frame) bool) {
+	if same == nil {
+		same = SameContent
+	}
+	m.window = window
+	m.same = same
+}
+
+// SameContent reports whether a and b carry the same event: the
+// same Evtnum, values and payload. Timestamps are not compared,
+// so copies restamped within an overlap window still match.
+func SameContent(a, b *tf.Frame) bool {
+	return a.GetEvtnum() == b.GetEvtnum() && a.GetV0() == b.GetV0() &&
+		a.GetV1() == b.GetV1() && bytes.Equal(a.Data, b.Data)
+}
+
+// NextFrame returns the earliest frame not yet returned from
+// any source, or io.EOF when all sources are exhausted. An
+// error from a source other than io.EOF is returned as is, and
+// that source is read again on the next call: no frame can be
+// returned until every source's head is known, so a source that
+// keeps failing stalls the merge rather than dropping out of it.
+// Frames already taken from the queue are kept for the next
+// call, though a group cut short is not de-duplicated.
+func (m *Merger) NextFrame() (*tf.Frame, error) {
+	for {
+		mf, err := m.nextKeyed()
+		if err != nil {
+			return nil, err
+		}
+		if m.same == nil || !m.overlapped(mf) {
+			return mf.f, nil
+		}
+	}
+}
+
+// nextKeyed returns the next frame, de-duplicated by Key.
+func (m *Merger) nextKeyed() (merged, error) {
+	if len(m.pending) > 0 {
+		mf := m.pending[0]
+		m.pending = m.pending[1:]
+		return mf, nil
+	}
+	f, i, err := m.next()
+	if err != nil || m.Key == nil {
+		return merged{f, i}, err
+	}
+
+	// gather every frame sharing this timestamp; sources are
+	// sorted, so they are all at the front of the queue by now.
+	group := []merged{{f, i}}
+	for {
+		if err := m.fill(); err != nil {
+			m.pending = append(m.pending, group...)
+			return merged{}, err
+		}
+		if m.pq.Len() == 0 || m.pq.First().Val.Tm() != f.Tm() {
+			break
+		}
+		g, j, _ := m.next()
+		group = append(group, merged{g, j})
+	}
+
+	chosen := make(map[string]int) // key -> index into group
+	keep := make([]bool, len(group))
+	for k, c := range group {
+		key := m.Key(c.f)
+		at, seen := chosen[key]
+		switch {
+		case !seen:
+			chosen[key] = k
+			keep[k] = true
+		case group[at].src == c.src:
+			keep[k] = true
+		case m.auth[c.src] && !m.auth[group[at].src]:
+			keep[at] = false
+			chosen[key] = k
+			keep[k] = true
+		}
+	}
+	for k, c := range group {
+		if keep[k] {
+			m.pending = append(m.pending, c)
+		}
+	}
+	mf := m.pending[0]
+	m.pending = m.pending[1:]
+	return mf, nil
+}
+
+// overlapped reports whether mf copies a recent frame from
+// another source, remembering mf for later frames if not.
+func (m *Merger) overlapped(mf merged) bool {
+	tm := mf.f.Tm()
+	k := 0
+	for k < len(m.recent) && tm-m.recent[k].f.Tm() > int64(m.window) {
+		k++
+	}
+	m.recent = m.recent[k:]
+	for i := range m.recent {
+		r := &m.recent[i]
+		if r.src != mf.src && !slices.Contains(r.matched, mf.src) && m.same(r.f, mf.f) {
+			r.matched = append(r.matched, mf.src)
+			m.Overlaps++
+			return true
+		}
+	}
+	m.recent = append(m.recent, recentFrame{merged: mf})
+	return false
+}
+
+// next pops the earliest head, once every source's head is
+// queued, and returns the frame and the source's index. The
+// source is refilled on the following call, since its next
+// frame cannot be earlier than this one.
+func (m *Merger) next() (*tf.Frame, int, error) {
+	if err := m.fill(); err != nil {
+		return nil, 0, err
+	}
+	pqe, ok := m.pq.PopPqe()
+	if !ok {
+		return nil, 0, io.EOF
+	}
+	i := m.from[pqe]
+	delete(m.from, pqe)
+	m.stale = append(m.stale, i)
+	return pqe.Val, i, nil
+}
+
+// fill refills the stale sources in order. A source whose
+// NextFrame fails stays stale, to be retried by the next fill.
+func (m *Merger) fill() error {
+	for len(m.stale) > 0 {
+		if err := m.refill(m.stale[0]); err != nil {
+			return err
+		}
+		m.stale = m.stale[1:]
+	}
+	return nil
+}
+
+// refill queues the next frame from source i, if it has one.
+func (m *Merger) refill(i int) error {
+	f, err := m.srcs[i].NextFrame()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pqe, err := m.pq.Add(f)
+	if err != nil {
+		return err
+	}
+	m.from[pqe] = i
+	return nil
+}
+
+// Merge reads the time-sorted tmframe streams in readers and
+// writes a single time-sorted tmframe stream to w.
+func Merge(w io.Writer, readers ...io.Reader) error {
+	srcs := make([]FrameSource, len(readers))
+	for i, r := range readers {
+		srcs[i] = NewReaderSource(r)
+	}
+	m := NewMerger(srcs...)
+	var buf []byte
+	for {
+		f, err := m.NextFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		buf, err = f.Marshal(buf[:0])
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+}
+
+// MergeChans receives from each of the time-sorted channels ins
+// until all are closed, sending a single time-sorted stream to
+// out, which it closes when done.
+func MergeChans(out chan<- *tf.Frame, ins ...<-chan *tf.Frame) {
+	defer close(out)
+	srcs := make([]FrameSource, len(ins))
+	for i, ch := range ins {
+		srcs[i] = NewChanSource(ch)
+	}
+	m := NewMerger(srcs...)
+	for {
+		f, err := m.NextFrame()
+		if err != nil {
+			return
+		}
+		out <- f
+	}
+}
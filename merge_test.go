@@ -0,0 +1,315 @@
+package pq
+
+import (
+	"bytes"
+	"fmt"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"testing"
+	"time"
+)
+
+func Test015MergeInterleavesSortedStreams(t *testing.T) {
+
+	cv.Convey("Merge of k sorted tmframe streams should reproduce the single sorted stream", t, func() {
+
+		n := 60
+		k := 3
+		frames, _, all := GenTestFrames(n, nil)
+
+		// deal the frames out unevenly across k streams
+		parts := make([]bytes.Buffer, k)
+		for i := range frames {
+			b, err := frames[i].Marshal(nil)
+			panicOn(err)
+			parts[(i*i)%k].Write(b)
+		}
+		var out bytes.Buffer
+		err := Merge(&out, &parts[0], &parts[1], &parts[2], &bytes.Buffer{})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(bytes.Equal(out.Bytes(), all), cv.ShouldBeTrue)
+	})
+
+	cv.Convey("MergeChans should merge sorted channels and close out when they are done", t, func() {
+
+		n := 40
+		frames, _, _ := GenTestFrames(n, nil)
+		a := make(chan *tf.Frame, n)
+		b := make(chan *tf.Frame, n)
+		for i := range frames {
+			if i%4 == 0 {
+				a <- frames[i]
+			} else {
+				b <- frames[i]
+			}
+		}
+		close(a)
+		close(b)
+
+		out := make(chan *tf.Frame)
+		go MergeChans(out, a, b)
+		i := 0
+		for f := range out {
+			cv.So(f, cv.ShouldEqual, frames[i])
+			i++
+		}
+		cv.So(i, cv.ShouldEqual, n)
+	})
+
+	cv.Convey("a source whose read fails should be read again on the next call, so no frame is lost", t, func() {
+
+		n := 12
+		frames, _, _ := GenTestFrames(n, nil)
+		a := make(chan *tf.Frame, n)
+		b := make(chan *tf.Frame, n)
+		for i := range frames {
+			if i%3 == 0 {
+				a <- frames[i]
+			} else {
+				b <- frames[i]
+			}
+		}
+		close(a)
+		close(b)
+
+		// the first source fails its first read, and again
+		// after its first frame.
+		bad := &flakySource{fail: 1, src: &oneThenSource{f: <-a, then: &flakySource{src: NewChanSource(a), fail: 1}}}
+		m := NewMerger(bad, NewChanSource(b))
+
+		var got []*tf.Frame
+		errs := 0
+		for {
+			f, err := m.NextFrame()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				errs++
+				cv.So(f, cv.ShouldBeNil)
+				continue
+			}
+			got = append(got, f)
+		}
+		cv.So(errs, cv.ShouldEqual, 2)
+		cv.So(got, cv.ShouldResemble, frames)
+	})
+}
+
+func Test027VerifiedSourceFailsFast(t *testing.T) {
+
+	cv.Convey("a Merger over a verified unsorted input should stop with an OrderError naming the bad frame", t, func() {
+
+		frames, _, _ := GenTestFrames(10, nil)
+		bad := []*tf.Frame{frames[0], frames[2], frames[1], frames[3]}
+		ch := make(chan *tf.Frame, len(bad))
+		for _, f := range bad {
+			ch <- f
+		}
+		close(ch)
+
+		good := make(chan *tf.Frame, 1)
+		good <- frames[9]
+		close(good)
+
+		m := NewMerger(NewVerifiedSource(NewChanSource(ch)), NewChanSource(good))
+		var err error
+		for err == nil {
+			_, err = m.NextFrame()
+		}
+		oe, ok := err.(*OrderError)
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(oe.Pos, cv.ShouldEqual, int64(2))
+		cv.So(oe.Frame, cv.ShouldEqual, frames[1])
+		cv.So(oe.Prev, cv.ShouldEqual, frames[2])
+	})
+}
+
+func Test032MergerAuthoritativeSourceWins(t *testing.T) {
+
+	cv.Convey("with Key set, an authoritative source's copy of a record should replace the live copy, whichever arrives first", t, func() {
+
+		t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+		mk := func(sec int, key int64, v float64) *tf.Frame {
+			f, err := tf.NewFrame(t0.Add(time.Duration(sec)*time.Second), tf.EvTwo64, v, key, nil)
+			panicOn(err)
+			return f
+		}
+		feed := func(fs ...*tf.Frame) FrameSource {
+			ch := make(chan *tf.Frame, len(fs))
+			for _, f := range fs {
+				ch <- f
+			}
+			close(ch)
+			return NewChanSource(ch)
+		}
+		// V1 is the record key, V0 says which feed it came from.
+		// Within a timestamp, frames come out in merge order.
+		live := feed(mk(0, 1, 0), mk(1, 1, 0), mk(1, 2, 0), mk(2, 1, 0))
+		fixed := feed(mk(1, 1, 1), mk(2, 3, 1))
+
+		m := NewMerger(live, fixed)
+		m.Key = func(f *tf.Frame) string { return fmt.Sprint(f.GetV1()) }
+		m.SetAuthoritative(1)
+
+		var got []string
+		for {
+			f, err := m.NextFrame()
+			if err == io.EOF {
+				break
+			}
+			cv.So(err, cv.ShouldBeNil)
+			got = append(got, fmt.Sprintf("%d/%d/%v", (f.Tm()-t0.UnixNano())/1e9, f.GetV1(), f.GetV0()))
+		}
+		cv.So(got, cv.ShouldResemble, []string{"0/1/0", "1/1/1", "1/2/0", "2/3/1", "2/1/0"})
+	})
+
+	cv.Convey("a source error while gathering a same-timestamp group should not lose the frames already gathered", t, func() {
+
+		t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+		mk := func(sec int, key int64) *tf.Frame {
+			f, err := tf.NewFrame(t0.Add(time.Duration(sec)*time.Second), tf.EvTwo64, 0, key, nil)
+			panicOn(err)
+			return f
+		}
+		ch := make(chan *tf.Frame, 3)
+		ch <- mk(1, 1)
+		ch <- mk(1, 2)
+		ch <- mk(2, 3)
+		close(ch)
+		// the second source fails on the read after its first frame.
+		done := make(chan *tf.Frame)
+		close(done)
+		src := &oneThenSource{f: mk(1, 4), then: &flakySource{src: NewChanSource(done), fail: 1}}
+
+		m := NewMerger(NewChanSource(ch), src)
+		m.Key = func(f *tf.Frame) string { return fmt.Sprint(f.GetV1()) }
+
+		_, err := m.NextFrame()
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(err, cv.ShouldNotEqual, io.EOF)
+
+		var keys []int64
+		for {
+			f, err := m.NextFrame()
+			if err == io.EOF {
+				break
+			}
+			cv.So(err, cv.ShouldBeNil)
+			keys = append(keys, f.GetV1())
+		}
+		cv.So(keys, cv.ShouldResemble, []int64{1, 4, 2, 3})
+	})
+}
+
+func Test039SplitChansPartitionsInOrder(t *testing.T) {
+
+	cv.Convey("SplitChans by time bucket should give each output an ordered sub-stream, and MergeChans should undo it", t, func() {
+
+		n := 90
+		frames, _, _ := GenTestFrames(n, nil)
+		in := make(chan *tf.Frame, n)
+		for _, f := range frames {
+			in <- f
+		}
+		close(in)
+
+		k := 3
+		outs := make([]chan *tf.Frame, k)
+		sendOuts := make([]chan<- *tf.Frame, k)
+		recvOuts := make([]<-chan *tf.Frame, k)
+		for i := range outs {
+			outs[i] = make(chan *tf.Frame, n)
+			sendOuts[i] = outs[i]
+			recvOuts[i] = outs[i]
+		}
+		part, err := ByTimeBucket(10 * time.Second)
+		cv.So(err, cv.ShouldBeNil)
+		SplitChans(in, part, sendOuts...)
+
+		for i := range outs {
+			cv.So(len(outs[i]), cv.ShouldEqual, n/k)
+		}
+		merged := make(chan *tf.Frame)
+		go MergeChans(merged, recvOuts...)
+		j := 0
+		for f := range merged {
+			cv.So(f, cv.ShouldEqual, frames[j])
+			cv.So(part(f, k), cv.ShouldEqual, (j/10)%k)
+			j++
+		}
+		cv.So(j, cv.ShouldEqual, n)
+
+		for _, d := range []time.Duration{0, -time.Second} {
+			_, err := ByTimeBucket(d)
+			cv.So(err, cv.ShouldEqual, ErrBucketWidth)
+		}
+
+		byKey := ByKeyHash(func(f *tf.Frame) string { return fmt.Sprint(f.GetEvtnum()) })
+		cv.So(byKey(frames[0], 4), cv.ShouldEqual, byKey(frames[3], 4))
+	})
+}
+
+// oneThenSource yields f, then reads from then.
+type oneThenSource struct {
+	f    *tf.Frame
+	then FrameSource
+}
+
+func (s *oneThenSource) NextFrame() (*tf.Frame, error) {
+	if s.f != nil {
+		f := s.f
+		s.f = nil
+		return f, nil
+	}
+	return s.then.NextFrame()
+}
+
+func Test066MergerDropsOverlapAcrossInputs(t *testing.T) {
+
+	cv.Convey("in overlap mode, a frame repeated by another input within the window should be passed on once, while repeats within one input, and look-alikes beyond the window, are kept", t, func() {
+
+		t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+		mk := func(ms int, v int64) *tf.Frame {
+			f, err := tf.NewFrame(t0.Add(time.Duration(ms)*time.Millisecond), tf.EvTwo64, 0, v, nil)
+			panicOn(err)
+			return f
+		}
+		span := func(from, to int) []*tf.Frame {
+			var fs []*tf.Frame
+			for s := from; s <= to; s++ {
+				fs = append(fs, mk(s*1000, int64(s)))
+			}
+			return fs
+		}
+
+		// a repeats its 5s frame; b repeats a's last three
+		// seconds, restamped 100ms late, and ends with a frame
+		// looking like a's 2s one; c repeats b's last two.
+		a := span(0, 10)
+		a = append(a[:6], append([]*tf.Frame{mk(5000, 5)}, a[6:]...)...)
+		b := []*tf.Frame{mk(8100, 8), mk(9100, 9), mk(10100, 10)}
+		b = append(b, span(11, 19)...)
+		b = append(b, mk(19500, 2))
+		c := append(span(18, 19), span(20, 25)...)
+
+		m := NewMerger(&sliceSource{frames: a}, &sliceSource{frames: b}, &sliceSource{frames: c})
+		m.SetOverlap(5*time.Second, nil)
+		var got []int64
+		for f, err := range Frames(m) {
+			cv.So(err, cv.ShouldBeNil)
+			got = append(got, f.GetV1())
+		}
+		want := []int64{0, 1, 2, 3, 4, 5, 5}
+		for s := int64(6); s <= 19; s++ {
+			want = append(want, s)
+		}
+		want = append(want, 2)
+		for s := int64(20); s <= 25; s++ {
+			want = append(want, s)
+		}
+		cv.So(got, cv.ShouldResemble, want)
+		cv.So(m.Overlaps, cv.ShouldEqual, int64(5))
+	})
+}
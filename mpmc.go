@@ -0,0 +1,121 @@
+package pq
+
+import (
+	tm "github.com/glycerine/tmframe"
+	"sync/atomic"
+)
+
+// ConcurrentQueue is a bounded multi-producer multi-consumer
+// queue after Dmitry Vyukov's design: each slot carries a
+// sequence number that tells producers and consumers, with a
+// single compare-and-swap on the shared position, whether the
+// slot is theirs to fill or empty. Several capture goroutines
+// can feed one bounded buffer, and several workers drain it,
+// with no mutex. Enqueue and Dequeue never block; they report
+// a full or empty queue instead.
+type ConcurrentQueue[T any] struct {
+	cells []mpmcCell[T]
+	mask  uint64
+
+	_   [64]byte
+	enq atomic.Uint64
+	_   [56]byte
+	deq atomic.Uint64
+	_   [56]byte
+}
+
+type mpmcCell[T any] struct {
+	seq atomic.Uint64
+	val T
+}
+
+// ConcurrentFrameQueue is a ConcurrentQueue of *tm.Frame.
+type ConcurrentFrameQueue = ConcurrentQueue[*tm.Frame]
+
+// NewConcurrentQueue returns a ConcurrentQueue holding at least
+// maxSize elements; the size is rounded up to a power of two,
+// and is at least 2.
+func NewConcurrentQueue[T any](maxSize int) *ConcurrentQueue[T] {
+	n := 2
+	for n < maxSize {
+		n <<= 1
+	}
+	q := &ConcurrentQueue[T]{
+		cells: make([]mpmcCell[T], n),
+		mask:  uint64(n - 1),
+	}
+	for i := range q.cells {
+		q.cells[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+// NewConcurrentFrameQueue returns a ConcurrentFrameQueue holding at least maxSize frames.
+func NewConcurrentFrameQueue(maxSize int) *ConcurrentFrameQueue {
+	return NewConcurrentQueue[*tm.Frame](maxSize)
+}
+
+// Cap returns the number of elements the queue can hold.
+func (q *ConcurrentQueue[T]) Cap() int {
+	return len(q.cells)
+}
+
+// Len returns the number of queued elements. Under concurrent
+// use it is a snapshot only.
+func (q *ConcurrentQueue[T]) Len() int {
+	n := int64(q.enq.Load() - q.deq.Load())
+	if n < 0 {
+		return 0
+	}
+	return int(n)
+}
+
+// Enqueue adds x, returning false if the queue is full.
+func (q *ConcurrentQueue[T]) Enqueue(x T) bool {
+	pos := q.enq.Load()
+	for {
+		c := &q.cells[pos&q.mask]
+		dif := int64(c.seq.Load()) - int64(pos)
+		switch {
+		case dif == 0:
+			if q.enq.CompareAndSwap(pos, pos+1) {
+				c.val = x
+				c.seq.Store(pos + 1)
+				return true
+			}
+			pos = q.enq.Load()
+		case dif < 0:
+			// the slot still holds an element a lap behind.
+			return false
+		default:
+			// another producer took this slot; catch up.
+			pos = q.enq.Load()
+		}
+	}
+}
+
+// Dequeue removes and returns the oldest element, with ok false
+// if the queue is empty.
+func (q *ConcurrentQueue[T]) Dequeue() (x T, ok bool) {
+	pos := q.deq.Load()
+	for {
+		c := &q.cells[pos&q.mask]
+		dif := int64(c.seq.Load()) - int64(pos+1)
+		switch {
+		case dif == 0:
+			if q.deq.CompareAndSwap(pos, pos+1) {
+				x = c.val
+				var zero T
+				c.val = zero
+				c.seq.Store(pos + q.mask + 1)
+				return x, true
+			}
+			pos = q.deq.Load()
+		case dif < 0:
+			// not yet filled: empty.
+			return x, false
+		default:
+			pos = q.deq.Load()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tm "github.com/glycerine/tmframe"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func Test045ConcurrentFrameQueueLosesNothing(t *testing.T) {
+
+	cv.Convey("several producers and consumers sharing a small ConcurrentFrameQueue should pass each frame exactly once, each producer's frames in order; run under -race", t, func() {
+
+		producers, consumers, per := 4, 3, 500
+		frames, _, _ := GenTestFrames(producers*per, nil)
+		q := NewConcurrentFrameQueue(8)
+		cv.So(q.Cap(), cv.ShouldEqual, 8)
+
+		var wg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			wg.Add(1)
+			go func(mine []*tm.Frame) {
+				defer wg.Done()
+				for _, f := range mine {
+					for !q.Enqueue(f) {
+						runtime.Gosched()
+					}
+				}
+			}(frames[p*per : (p+1)*per])
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		var mu sync.Mutex
+		seen := make(map[*tm.Frame]int)
+		var cg sync.WaitGroup
+		for c := 0; c < consumers; c++ {
+			cg.Add(1)
+			go func() {
+				defer cg.Done()
+				last := make([]int64, producers)
+				for {
+					f, ok := q.Dequeue()
+					if !ok {
+						select {
+						case <-done:
+							if q.Len() == 0 {
+								return
+							}
+						default:
+						}
+						runtime.Gosched()
+						continue
+					}
+					// a single consumer sees each producer's frames in order
+					p := 0
+					for frames[(p+1)*per-1].Tm() < f.Tm() {
+						p++
+					}
+					if f.Tm() <= last[p] {
+						panic("out of order within a producer")
+					}
+					last[p] = f.Tm()
+					mu.Lock()
+					seen[f]++
+					mu.Unlock()
+				}
+			}()
+		}
+		cg.Wait()
+
+		cv.So(len(seen), cv.ShouldEqual, producers*per)
+		for _, k := range seen {
+			cv.So(k, cv.ShouldEqual, 1)
+		}
+		_, ok := q.Dequeue()
+		cv.So(ok, cv.ShouldBeFalse)
+	})
+}
@@ -2,7 +2,9 @@ package pq
 
 import (
 	"container/heap"
+	"errors"
 	tf "github.com/glycerine/tmframe"
+	"sort"
 	"time"
 )
 
@@ -13,19 +15,120 @@ type Pqe struct {
 
 	// The Idx is needed by Update and is maintained by the heap.Interface methods.
 	Idx int // The index of the item in the heap.
+
+	// Gen is bumped every time the entry is updated or leaves
+	// the queue. Save it alongside the *Pqe and hand both to
+	// UpdateIfCurrent to detect a stale handle.
+	Gen uint64
+
+	// InsertSeq is the order in which the entry entered the
+	// queue; it breaks ties between equal OrderBy values when
+	// the queue's StableTies is set.
+	InsertSeq uint64
+
+	dkey string // dedup key, when the queue is in a dedup mode
 }
 
+// ErrStalePqe is returned by UpdateIfCurrent when the
+// handle no longer refers to a live entry of the queue.
+var ErrStalePqe = errors.New("pq: stale Pqe handle: entry was popped, moved, or updated")
+
 // A PriorityQueue implements heap.Interface and holds Pqes.
 type PriorityQueue struct {
 	Seq []*Pqe
+
+	// Journal, if non-nil, records recent operations for postmortems.
+	Journal *Journal
+
+	// Stats, if non-nil, counts the queue's traffic. See EnableStats.
+	Stats *QueueStats
+
+	// SizeFunc, if non-nil, measures frame payloads for MemUsage
+	// and the per-Evtnum byte budgets.
+	SizeFunc SizeFunc
+
+	// ByEvtnum holds per-Evtnum accounting once
+	// EnableEvtnumStats or SetEvtnumBudget has been called.
+	ByEvtnum map[tf.Evtnum]*EvtnumStats
+
+	// Evictor, if non-nil, picks frames to evict when a
+	// budget would be exceeded, rather than rejecting the
+	// incoming frame.
+	Evictor Evictor
+
+	// MaxLen, if > 0, bounds the number of entries Add will
+	// allow; Policy says what gives way when it is reached.
+	// See NewBoundedPriorityQueue.
+	MaxLen int
+	Policy EvictPolicy
+
+	// LessFunc, if non-nil, replaces the default ordering by
+	// OrderBy. See NewPriorityQueueWithLess.
+	LessFunc func(a, b *Pqe) bool
+
+	// StableTies makes entries that compare equal pop in the
+	// order they were added (FIFO). NewPriorityQueue turns it on;
+	// clear it to save the comparison if tie order is immaterial.
+	StableTies bool
+	nextSeq    uint64
+
+	reserved int // slots held by open Reservations
+
+	observer func(Event) // see SetObserver
+
+	dedupMode DedupMode
+	dedupKey  func(*tf.Frame) string
+	dedup     map[string]*Pqe // live entries by dedup key; see SetDedup
+
+	byTime []*Pqe // live entries in time order; see EnableRangeIndex
+
+	pub *Publisher // see PublishTo
 }
 
 func NewPriorityQueue() *PriorityQueue {
 	return &PriorityQueue{
-		Seq: make([]*Pqe, 0),
+		Seq:        make([]*Pqe, 0),
+		StableTies: true,
 	}
 }
 
+// NewPriorityQueueFrom returns a queue holding frames, built
+// with a single O(n) heap.Init rather than n calls to Add.
+// Frames sharing a timestamp pop in their order in frames. The
+// slice itself is not retained, but the frames are shared, not
+// copied; they must be non-nil.
+func NewPriorityQueueFrom(frames []*tf.Frame) *PriorityQueue {
+	pq := &PriorityQueue{
+		Seq:        make([]*Pqe, len(frames)),
+		StableTies: true,
+		nextSeq:    uint64(len(frames)),
+	}
+	for i, f := range frames {
+		pq.Seq[i] = &Pqe{
+			Val:       f,
+			OrderBy:   time.Unix(0, f.Tm()),
+			Idx:       i,
+			InsertSeq: uint64(i),
+		}
+	}
+	heap.Init(pq)
+	return pq
+}
+
+// NewPriorityQueueWithLess returns a queue ordered by less
+// instead of by OrderBy: less(a, b) reports whether a should
+// be popped before b. This allows ordering by frame type,
+// payload-derived sequence numbers, or composite keys.
+//
+// Time-window methods (Extract, MoveUntil) still select entries
+// by OrderBy; with a custom ordering they must scan the whole
+// queue rather than prune by heap order.
+func NewPriorityQueueWithLess(less func(a, b *Pqe) bool) *PriorityQueue {
+	pq := NewPriorityQueue()
+	pq.LessFunc = less
+	return pq
+}
+
 func (pq *PriorityQueue) First() *Pqe {
 	return pq.Seq[0]
 }
@@ -33,7 +136,23 @@ func (pq *PriorityQueue) First() *Pqe {
 func (pq *PriorityQueue) Len() int { return len(pq.Seq) }
 
 func (pq *PriorityQueue) Less(i, j int) bool {
-	return pq.Seq[i].OrderBy.Before(pq.Seq[j].OrderBy)
+	return pq.less(pq.Seq[i], pq.Seq[j])
+}
+
+func (pq *PriorityQueue) less(a, b *Pqe) bool {
+	if pq.LessFunc != nil {
+		if pq.LessFunc(a, b) {
+			return true
+		}
+		if !pq.StableTies || pq.LessFunc(b, a) {
+			return false
+		}
+	} else {
+		if !a.OrderBy.Equal(b.OrderBy) || !pq.StableTies {
+			return a.OrderBy.Before(b.OrderBy)
+		}
+	}
+	return a.InsertSeq < b.InsertSeq
 }
 
 func (pq *PriorityQueue) Swap(i, j int) {
@@ -46,7 +165,13 @@ func (pq *PriorityQueue) Push(x interface{}) {
 	n := len(pq.Seq)
 	item := x.(*Pqe)
 	item.Idx = n
+	item.InsertSeq = pq.nextSeq
+	pq.nextSeq++
 	pq.Seq = append(pq.Seq, item)
+	pq.account(item.Val, 1)
+	pq.dedupTrack(item)
+	pq.indexTrack(item)
+	pq.record(JournalAdd, item.OrderBy, "push")
 }
 
 func (pq *PriorityQueue) Pop() interface{} {
@@ -54,30 +179,403 @@ func (pq *PriorityQueue) Pop() interface{} {
 	n := len(old)
 	item := old[n-1]
 	item.Idx = -1 // for safety
+	item.Gen++
 	pq.Seq = old[0 : n-1]
+	pq.account(item.Val, -1)
+	pq.dedupForget(item)
+	pq.indexForget(item)
+	pq.record(JournalPop, item.OrderBy, "")
+	if pq.pub != nil {
+		pq.pub.Publish(item.Val)
+	}
 	return item
 }
 
+// PopPqe removes and returns the earliest entry in the queue,
+// maintaining the heap invariants. ok is false if the queue is empty.
+func (pq *PriorityQueue) PopPqe() (pqe *Pqe, ok bool) {
+	if len(pq.Seq) == 0 {
+		return nil, false
+	}
+	return heap.Pop(pq).(*Pqe), true
+}
+
+// PopFrame removes the earliest entry in the queue and returns
+// its frame. ok is false if the queue is empty.
+func (pq *PriorityQueue) PopFrame() (frame *tf.Frame, ok bool) {
+	pqe, ok := pq.PopPqe()
+	if !ok {
+		return nil, false
+	}
+	return pqe.Val, true
+}
+
+// Remove takes pqe out of the queue, wherever it sits in the
+// heap, in O(log n). It returns ErrStalePqe if pqe is not
+// currently in this queue.
+func (pq *PriorityQueue) Remove(pqe *Pqe) error {
+	if pqe == nil || !pq.isCurrent(pqe, pqe.Gen) {
+		return ErrStalePqe
+	}
+	heap.Remove(pq, pqe.Idx)
+	return nil
+}
+
 // Update modifies the priority and value of an Pqe in the queue.
 // The pqe must already be in the queue at pqe.Idx location, as
 // when it was returned by PriorityQueue.Add().
 func (pq *PriorityQueue) Update(pqe *Pqe, value *tf.Frame) {
+	pq.account(pqe.Val, -1)
+	pq.account(value, 1)
+	pq.dedupForget(pqe)
+	pq.indexForget(pqe)
 	pqe.Val = value
 	pqe.OrderBy = time.Unix(0, value.Tm())
+	pqe.Gen++
+	pq.dedupTrack(pqe)
+	pq.indexTrack(pqe)
 	heap.Fix(pq, pqe.Idx)
+	pq.record(JournalUpdate, pqe.OrderBy, "")
 }
 
+// UpdateIfCurrent is like Update, but first verifies that pqe
+// is still in this queue at pqe.Idx and that its Gen still
+// equals gen, the generation observed when the caller obtained
+// the handle. If not, ErrStalePqe is returned and the heap is left
+// untouched. UpdateIfCurrent does no locking of its own: callers
+// sharing a queue across goroutines must hold their queue lock
+// around it, exactly as for Update.
+func (pq *PriorityQueue) UpdateIfCurrent(pqe *Pqe, gen uint64, value *tf.Frame) error {
+	if !pq.isCurrent(pqe, gen) {
+		pq.record(JournalReject, time.Unix(0, value.Tm()), ErrStalePqe.Error())
+		return ErrStalePqe
+	}
+	pq.Update(pqe, value)
+	return nil
+}
+
+// isCurrent reports whether pqe, at generation gen, is a live member of pq.
+func (pq *PriorityQueue) isCurrent(pqe *Pqe, gen uint64) bool {
+	if pqe == nil || pqe.Gen != gen {
+		return false
+	}
+	if pqe.Idx < 0 || pqe.Idx >= len(pq.Seq) {
+		return false
+	}
+	return pq.Seq[pqe.Idx] == pqe
+}
+
+// Add inserts frame into the queue, ordered by its timestamp.
+// If per-Evtnum budgets are set and frame would exceed the
+// budget for its Evtnum, Add returns ErrEvtnumBudget and does
+// not queue the frame. Likewise a bounded queue that is full
+// returns ErrFull if its Policy refuses the frame, and a queue
+// in a dedup mode returns ErrDuplicate, with the existing
+// entry, for a frame whose key is already queued (see SetDedup).
 func (pq *PriorityQueue) Add(frame *tf.Frame) (*Pqe, error) {
+	if dup := pq.dedupLookup(frame); dup != nil {
+		if pq.dedupMode == DedupReplace {
+			pq.Update(dup, frame)
+		} else {
+			pq.record(JournalReject, time.Unix(0, frame.Tm()), ErrDuplicate.Error())
+		}
+		return dup, ErrDuplicate
+	}
+	if err := pq.makeRoomFor(frame); err != nil {
+		return nil, err
+	}
 	pqe := &Pqe{
-		Val:     frame,
-		OrderBy: time.Unix(0, frame.Tm()),
-		Idx:     len(pq.Seq),
+		Val:       frame,
+		OrderBy:   time.Unix(0, frame.Tm()),
+		Idx:       len(pq.Seq),
+		InsertSeq: pq.nextSeq,
 	}
+	pq.nextSeq++
 	pq.Seq = append(pq.Seq, pqe)
 	heap.Fix(pq, pqe.Idx)
+	pq.account(frame, 1)
+	pq.dedupTrack(pqe)
+	pq.indexTrack(pqe)
+	pq.record(JournalAdd, pqe.OrderBy, "")
 	return pqe, nil
 }
 
+// makeRoomFor applies the per-Evtnum budgets and the MaxLen
+// bound to an incoming frame, evicting as they allow, and
+// returns the error to refuse it with, if any.
+func (pq *PriorityQueue) makeRoomFor(frame *tf.Frame) error {
+	if !pq.admit(frame) {
+		pq.record(JournalReject, time.Unix(0, frame.Tm()), ErrEvtnumBudget.Error())
+		return ErrEvtnumBudget
+	}
+	if !pq.makeRoom(frame) {
+		pq.record(JournalReject, time.Unix(0, frame.Tm()), ErrFull.Error())
+		return ErrFull
+	}
+	return nil
+}
+
 func (pq *PriorityQueue) Reinit() {
 	heap.Init(pq)
+	if pq.byTime != nil {
+		pq.byTime = nil
+		pq.EnableRangeIndex()
+	}
+}
+
+// Bound says whether a range endpoint is itself part of the range.
+type Bound int
+
+const (
+	Inclusive Bound = iota
+	Exclusive
+)
+
+// Extract returns, in chronological order, copies of the
+// pointers to all frames in the queue whose OrderBy
+// falls within [from, to). The queue itself is not modified.
+func (pq *PriorityQueue) Extract(from, to time.Time) []*tf.Frame {
+	return pq.ExtractBounds(from, Inclusive, to, Exclusive)
+}
+
+// ExtractBounds is Extract with the inclusiveness of each
+// endpoint spelled out. Bounds compare whole timestamps, so a
+// group of frames sharing the timestamp at an endpoint is
+// always taken or left as a unit, never split. Within such a
+// group frames come back in the order they were added.
+func (pq *PriorityQueue) ExtractBounds(from time.Time, fromB Bound, to time.Time, toB Bound) []*tf.Frame {
+	hits := pq.entriesWithin(from, fromB, to, toB)
+	res := make([]*tf.Frame, len(hits))
+	for i := range hits {
+		res[i] = hits[i].Val
+	}
+	return res
+}
+
+// entriesWithin returns, in time order, the entries between
+// from and to, using the time index if there is one and
+// otherwise walking the heap, pruning every subtree rooted
+// past to.
+func (pq *PriorityQueue) entriesWithin(from time.Time, fromB Bound, to time.Time, toB Bound) []*Pqe {
+	if pq.byTime != nil {
+		return pq.indexWithin(from, fromB, to, toB)
+	}
+	var hits []*Pqe
+	pq.walkWhile(0, func(t time.Time) bool {
+		return t.Before(to) || (toB == Inclusive && t.Equal(to))
+	}, func(pqe *Pqe) {
+		if pqe.OrderBy.After(from) || (fromB == Inclusive && pqe.OrderBy.Equal(from)) {
+			hits = append(hits, pqe)
+		}
+	})
+	sort.Sort(pqeByTime(hits))
+	return hits
+}
+
+// walkBefore visits every entry in the subtree rooted
+// at heap index i whose OrderBy is before limit.
+func (pq *PriorityQueue) walkBefore(i int, limit time.Time, visit func(pqe *Pqe)) {
+	pq.walkWhile(i, func(t time.Time) bool { return t.Before(limit) }, visit)
+}
+
+// walkWhile visits every entry in the subtree rooted at heap
+// index i whose OrderBy satisfies in, which must hold for every
+// time earlier than one it holds for. Because a heap parent is
+// never later than its children, we can prune a whole subtree
+// as soon as its root fails in. Under a custom LessFunc that
+// no longer holds, so we scan.
+func (pq *PriorityQueue) walkWhile(i int, in func(time.Time) bool, visit func(pqe *Pqe)) {
+	if pq.LessFunc != nil {
+		for _, pqe := range pq.Seq[i:] {
+			if in(pqe.OrderBy) {
+				visit(pqe)
+			}
+		}
+		return
+	}
+	if i >= len(pq.Seq) {
+		return
+	}
+	pqe := pq.Seq[i]
+	if !in(pqe.OrderBy) {
+		return
+	}
+	visit(pqe)
+	pq.walkWhile(2*i+1, in, visit)
+	pq.walkWhile(2*i+2, in, visit)
+}
+
+// pqeByTime sorts a slice of *Pqe by OrderBy, earliest first,
+// with equal times in insertion order.
+type pqeByTime []*Pqe
+
+func (s pqeByTime) Len() int           { return len(s) }
+func (s pqeByTime) Less(i, j int) bool { return earlier(s[i], s[j]) }
+func (s pqeByTime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// earlier orders entries as pqeByTime does.
+func earlier(a, b *Pqe) bool {
+	if a.OrderBy.Equal(b.OrderBy) {
+		return a.InsertSeq < b.InsertSeq
+	}
+	return a.OrderBy.Before(b.OrderBy)
+}
+
+// MoveUntil transfers every entry whose OrderBy is before t
+// from pq into dst, all or none, and returns the number of
+// entries moved. dst must be able to take every one of them as
+// they are: none may be a duplicate under dst's dedup mode,
+// and together they must fit dst's Evtnum budgets and bound
+// without evicting anything. Otherwise nothing moves, and
+// MoveUntil returns 0 with the error Add would have given
+// (ErrDuplicate, ErrEvtnumBudget or ErrFull). Each moved *Pqe
+// keeps its frame and OrderBy but has its Gen bumped, so
+// outstanding handles to it go stale. MoveUntil does no
+// locking; callers sharing either queue across goroutines must
+// hold both queue locks for the duration.
+func (pq *PriorityQueue) MoveUntil(dst *PriorityQueue, t time.Time) (int, error) {
+	if dst == pq {
+		return 0, nil
+	}
+	var early []*Pqe
+	pq.walkBefore(0, t, func(pqe *Pqe) { early = append(early, pqe) })
+	if err := dst.admitAll(early); err != nil {
+		return 0, err
+	}
+	sort.Slice(early, func(i, j int) bool { return pq.less(early[i], early[j]) })
+	pub := pq.pub
+	pq.pub = nil // moved frames are not released
+	for _, pqe := range early {
+		heap.Remove(pq, pqe.Idx)
+		heap.Push(dst, pqe)
+	}
+	pq.pub = pub
+	return len(early), nil
+}
+
+// admitAll reports, without changing anything, why pq could not
+// take all of pqes without evicting, or nil if it could. The
+// refused frame is recorded as a reject.
+func (pq *PriorityQueue) admitAll(pqes []*Pqe) error {
+	if len(pqes) == 0 {
+		return nil
+	}
+	if pq.MaxLen > 0 && len(pq.Seq)+pq.reserved+len(pqes) > pq.MaxLen {
+		pq.record(JournalReject, pqes[0].OrderBy, ErrFull.Error())
+		return ErrFull
+	}
+	seen := make(map[string]bool)
+	type usage struct{ count, bytes int64 }
+	used := make(map[tf.Evtnum]*usage)
+	for _, pqe := range pqes {
+		if pq.dedup != nil {
+			key := pq.dedupKey(pqe.Val)
+			if pq.dedup[key] != nil || seen[key] {
+				pq.record(JournalReject, pqe.OrderBy, ErrDuplicate.Error())
+				return ErrDuplicate
+			}
+			seen[key] = true
+		}
+		if pq.ByEvtnum == nil {
+			continue
+		}
+		ev := pqe.Val.GetEvtnum()
+		st, ok := pq.ByEvtnum[ev]
+		if !ok {
+			continue
+		}
+		u := used[ev]
+		if u == nil {
+			u = &usage{}
+			used[ev] = u
+		}
+		size := pq.sizeOf(pqe.Val)
+		if overBudget(st, st.Count+u.count, st.Bytes+u.bytes, size) {
+			pq.record(JournalReject, pqe.OrderBy, ErrEvtnumBudget.Error())
+			return ErrEvtnumBudget
+		}
+		u.count++
+		u.bytes += size
+	}
+	return nil
+}
+
+// PopUntil removes and returns, in pop order, every entry
+// whose OrderBy is before t. It returns nil if there are none.
+// As with MoveUntil, under a custom LessFunc the whole queue is
+// searched, since early entries need not be at the front.
+func (pq *PriorityQueue) PopUntil(t time.Time) []*Pqe {
+	var res []*Pqe
+	if pq.LessFunc != nil {
+		pq.walkBefore(0, t, func(pqe *Pqe) { res = append(res, pqe) })
+		for _, pqe := range res {
+			heap.Remove(pq, pqe.Idx)
+		}
+		sort.Slice(res, func(i, j int) bool { return pq.less(res[i], res[j]) })
+		return res
+	}
+	for pq.Len() > 0 && pq.First().OrderBy.Before(t) {
+		res = append(res, heap.Pop(pq).(*Pqe))
+	}
+	return res
+}
+
+// PopN removes and returns, in pop order, up to n entries from
+// the front of the queue; fewer if the queue runs out first.
+func (pq *PriorityQueue) PopN(n int) []*Pqe {
+	if n > pq.Len() {
+		n = pq.Len()
+	}
+	if n <= 0 {
+		return nil
+	}
+	res := make([]*Pqe, n)
+	for i := range res {
+		res[i] = heap.Pop(pq).(*Pqe)
+	}
+	return res
+}
+
+// PeekN returns, in pop order, up to n of the entries that
+// would be popped next, without modifying the queue. It walks
+// the heap best-first, so it costs O(n log n) however long the
+// queue is. The returned *Pqe are the live entries; do not
+// change them except through Update.
+func (pq *PriorityQueue) PeekN(n int) []*Pqe {
+	if n > pq.Len() {
+		n = pq.Len()
+	}
+	if n <= 0 {
+		return nil
+	}
+	res := make([]*Pqe, 0, n)
+	front := &peekFrontier{pq: pq, idx: []int{0}}
+	for len(res) < n {
+		i := heap.Pop(front).(int)
+		res = append(res, pq.Seq[i])
+		for _, c := range [2]int{2*i + 1, 2*i + 2} {
+			if c < len(pq.Seq) {
+				heap.Push(front, c)
+			}
+		}
+	}
+	return res
+}
+
+// peekFrontier is a heap of indices into pq.Seq, ordered as
+// pq orders their entries; PeekN uses it to visit the heap
+// in pop order.
+type peekFrontier struct {
+	pq  *PriorityQueue
+	idx []int
+}
+
+func (f *peekFrontier) Len() int           { return len(f.idx) }
+func (f *peekFrontier) Less(i, j int) bool { return f.pq.Less(f.idx[i], f.idx[j]) }
+func (f *peekFrontier) Swap(i, j int)      { f.idx[i], f.idx[j] = f.idx[j], f.idx[i] }
+func (f *peekFrontier) Push(x interface{}) { f.idx = append(f.idx, x.(int)) }
+func (f *peekFrontier) Pop() interface{} {
+	i := f.idx[len(f.idx)-1]
+	f.idx = f.idx[:len(f.idx)-1]
+	return i
 }
@@ -1,6 +1,7 @@
 package pq
 
 import (
+	"bytes"
 	"container/heap"
 	cryptorand "crypto/rand"
 	"encoding/binary"
@@ -8,6 +9,7 @@ import (
 	cv "github.com/glycerine/goconvey/convey"
 	tf "github.com/glycerine/tmframe"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -106,3 +108,515 @@ func cryptoRandNonNegInt() int {
 	}
 	return r
 }
+
+func Test002ExtractIsNonDestructive(t *testing.T) {
+
+	cv.Convey("Extract(from, to) should return the frames in [from, to) in time order, leaving the queue intact", t, func() {
+
+		n := 50
+		frames, tms, _ := GenTestFrames(n, nil)
+
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[n-1-i])
+		}
+
+		got := pq.Extract(tms[10], tms[20])
+		cv.So(len(got), cv.ShouldEqual, 10)
+		for i := range got {
+			cv.So(got[i], cv.ShouldEqual, frames[10+i])
+		}
+		cv.So(pq.Len(), cv.ShouldEqual, n)
+
+		cv.So(len(pq.Extract(tms[n-1].Add(time.Second), tms[n-1].Add(time.Hour))), cv.ShouldEqual, 0)
+	})
+}
+
+func Test003UpdateIfCurrentRejectsStaleHandles(t *testing.T) {
+
+	cv.Convey("UpdateIfCurrent should refuse handles to popped or already-updated entries", t, func() {
+
+		frames, _, _ := GenTestFrames(10, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+
+		// pop the head, then try to update through the old handle.
+		head := pq.First()
+		gen := head.Gen
+		heap.Pop(pq)
+		cv.So(pq.UpdateIfCurrent(head, gen, frames[9]), cv.ShouldEqual, ErrStalePqe)
+
+		// a current handle works once, then goes stale.
+		pqe := pq.First()
+		gen = pqe.Gen
+		cv.So(pq.UpdateIfCurrent(pqe, gen, frames[9]), cv.ShouldBeNil)
+		cv.So(pq.UpdateIfCurrent(pqe, gen, frames[9]), cv.ShouldEqual, ErrStalePqe)
+		cv.So(pq.UpdateIfCurrent(pqe, pqe.Gen, frames[8]), cv.ShouldBeNil)
+		cv.So(pq.Len(), cv.ShouldEqual, 9)
+	})
+}
+
+func Test005MoveUntilTransfersTheEarlyEntries(t *testing.T) {
+
+	cv.Convey("MoveUntil should move exactly the entries before t, without duplicates or loss", t, func() {
+
+		n := 40
+		frames, tms, _ := GenTestFrames(n, nil)
+		src := NewPriorityQueue()
+		dst := NewPriorityQueue()
+		for i := range frames {
+			if i%2 == 0 {
+				src.Add(frames[i])
+			} else {
+				dst.Add(frames[i])
+			}
+		}
+
+		moved, err := src.MoveUntil(dst, tms[20])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(moved, cv.ShouldEqual, 10)
+		cv.So(src.Len()+dst.Len(), cv.ShouldEqual, n)
+		cv.So(src.First().OrderBy.Equal(tms[20]), cv.ShouldBeTrue)
+
+		for i := 0; i < 20; i++ {
+			pqe := heap.Pop(dst).(*Pqe)
+			cv.So(pqe.Val, cv.ShouldEqual, frames[i])
+		}
+	})
+
+	cv.Convey("MoveUntil should move nothing, and evict nothing, unless dst can take every early entry", t, func() {
+
+		n := 10
+		frames, tms, _ := GenTestFrames(n, nil)
+		src := NewPriorityQueue()
+		for i := range frames {
+			src.Add(frames[i])
+		}
+		for _, policy := range []EvictPolicy{RejectNewest, EvictEarliest, EvictLatest} {
+			dst := NewBoundedPriorityQueue(3, policy)
+			dst.Add(frames[0])
+			moved, err := src.MoveUntil(dst, tms[n-1].Add(time.Second))
+			cv.So(err, cv.ShouldEqual, ErrFull)
+			cv.So(moved, cv.ShouldEqual, 0)
+			cv.So(dst.Len(), cv.ShouldEqual, 1)
+			cv.So(src.Len(), cv.ShouldEqual, n)
+		}
+		cv.So(src.Validate(), cv.ShouldBeNil)
+
+		ded := NewPriorityQueue()
+		ded.SetDedup(DedupReject, nil)
+		ded.Add(frames[4])
+		moved, err := src.MoveUntil(ded, tms[6])
+		cv.So(err, cv.ShouldEqual, ErrDuplicate)
+		cv.So(moved, cv.ShouldEqual, 0)
+		cv.So(ded.Len(), cv.ShouldEqual, 1)
+		cv.So(src.Len(), cv.ShouldEqual, n)
+
+		capped := NewPriorityQueue()
+		capped.SetEvtnumBudget(frames[0].GetEvtnum(), 1, 0)
+		cv.So(frames[3].GetEvtnum(), cv.ShouldEqual, frames[0].GetEvtnum())
+		moved, err = src.MoveUntil(capped, tms[4])
+		cv.So(err, cv.ShouldEqual, ErrEvtnumBudget)
+		cv.So(moved, cv.ShouldEqual, 0)
+		cv.So(src.Len(), cv.ShouldEqual, n)
+
+		moved, err = src.MoveUntil(ded, tms[4])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(moved, cv.ShouldEqual, 4)
+		cv.So(ded.Len(), cv.ShouldEqual, 5)
+		cv.So(src.First().Val, cv.ShouldEqual, frames[4])
+		cv.So(src.Validate(), cv.ShouldBeNil)
+		cv.So(ded.Validate(), cv.ShouldBeNil)
+	})
+}
+
+func Test010MemUsageCountsPayloads(t *testing.T) {
+
+	cv.Convey("MemUsage should account for entries, frames, and payload bytes", t, func() {
+
+		frames, _, _ := GenTestFrames(12, nil)
+		pq := NewPriorityQueue()
+		var payload int64
+		for i := range frames {
+			pq.Add(frames[i])
+			payload += int64(cap(frames[i].Data))
+		}
+		r := pq.MemUsage()
+		cv.So(r.Payload, cv.ShouldEqual, payload)
+		cv.So(r.Entries, cv.ShouldEqual, 12*pqeBytes)
+		cv.So(r.Total, cv.ShouldEqual, r.Backing+r.Entries+r.Frames+r.Payload)
+
+		pq.SizeFunc = func(f *tf.Frame) int64 { return 1 }
+		cv.So(pq.MemUsage().Payload, cv.ShouldEqual, int64(12))
+	})
+}
+
+func Test013PopFrameDrainsInOrder(t *testing.T) {
+
+	cv.Convey("PopFrame should drain the queue in time order and then report ok=false", t, func() {
+
+		n := 20
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[n-1-i])
+		}
+		for i := 0; i < n; i++ {
+			f, ok := pq.PopFrame()
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(f, cv.ShouldEqual, frames[i])
+		}
+		f, ok := pq.PopFrame()
+		cv.So(ok, cv.ShouldBeFalse)
+		cv.So(f, cv.ShouldBeNil)
+		pqe, ok := pq.PopPqe()
+		cv.So(ok, cv.ShouldBeFalse)
+		cv.So(pqe, cv.ShouldBeNil)
+	})
+}
+
+func Test017RemoveCancelsAnEntry(t *testing.T) {
+
+	cv.Convey("Remove should cancel an arbitrary entry and keep the heap ordered", t, func() {
+
+		n := 25
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		handles := make([]*Pqe, n)
+		for i := range frames {
+			handles[n-1-i], _ = pq.Add(frames[n-1-i])
+		}
+		cv.So(pq.Remove(handles[7]), cv.ShouldBeNil)
+		cv.So(pq.Remove(handles[7]), cv.ShouldEqual, ErrStalePqe)
+		cv.So(pq.Remove(handles[0]), cv.ShouldBeNil)
+
+		other := NewPriorityQueue()
+		cv.So(other.Remove(handles[3]), cv.ShouldEqual, ErrStalePqe)
+
+		cv.So(pq.Len(), cv.ShouldEqual, n-2)
+		for i := 1; i < n; i++ {
+			if i == 7 {
+				continue
+			}
+			f, _ := pq.PopFrame()
+			cv.So(f, cv.ShouldEqual, frames[i])
+		}
+	})
+}
+
+func Test018CustomComparatorOrdersByEvtnum(t *testing.T) {
+
+	cv.Convey("a queue built with NewPriorityQueueWithLess should pop in the comparator's order", t, func() {
+
+		n := 30
+		frames, tms, _ := GenTestFrames(n, nil)
+
+		// by Evtnum, then by time within an Evtnum.
+		pq := NewPriorityQueueWithLess(func(a, b *Pqe) bool {
+			ea, eb := a.Val.GetEvtnum(), b.Val.GetEvtnum()
+			if ea != eb {
+				return ea < eb
+			}
+			return a.OrderBy.Before(b.OrderBy)
+		})
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+
+		// time-window queries still work under the custom ordering.
+		cv.So(pq.Extract(tms[3], tms[6]), cv.ShouldResemble, frames[3:6])
+
+		prev, _ := pq.PopPqe()
+		for pq.Len() > 0 {
+			cur, _ := pq.PopPqe()
+			cv.So(cur.Val.GetEvtnum() >= prev.Val.GetEvtnum(), cv.ShouldBeTrue)
+			if cur.Val.GetEvtnum() == prev.Val.GetEvtnum() {
+				cv.So(cur.OrderBy.After(prev.OrderBy), cv.ShouldBeTrue)
+			}
+			prev = cur
+		}
+	})
+}
+
+func Test019EqualTimestampsPopFIFO(t *testing.T) {
+
+	cv.Convey("frames sharing a timestamp should pop in insertion order when StableTies is on, the default", t, func() {
+
+		t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+		n := 50
+		var frames []*tf.Frame
+		for i := 0; i < n; i++ {
+			f, err := tf.NewFrame(t0.Add(time.Duration(i%3)*time.Second), tf.EvTwo64, float64(i), int64(i), nil)
+			panicOn(err)
+			frames = append(frames, f)
+		}
+		pq := NewPriorityQueue()
+		cv.So(pq.StableTies, cv.ShouldBeTrue)
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		prev, _ := pq.PopFrame()
+		for pq.Len() > 0 {
+			cur, _ := pq.PopFrame()
+			if cur.Tm() == prev.Tm() {
+				cv.So(cur.GetV1() > prev.GetV1(), cv.ShouldBeTrue)
+			} else {
+				cv.So(cur.Tm() > prev.Tm(), cv.ShouldBeTrue)
+			}
+			prev = cur
+		}
+	})
+}
+
+func Test021DumpDotDescribesTheHeap(t *testing.T) {
+
+	cv.Convey("DumpDot should emit one node per entry and one edge per parent-child pair", t, func() {
+
+		frames, _, _ := GenTestFrames(7, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		var buf bytes.Buffer
+		cv.So(pq.DumpDot(&buf), cv.ShouldBeNil)
+		dot := buf.String()
+		cv.So(strings.HasPrefix(dot, "digraph pq {"), cv.ShouldBeTrue)
+		cv.So(strings.Count(dot, "[label="), cv.ShouldEqual, 7)
+		cv.So(strings.Count(dot, " -> "), cv.ShouldEqual, 6)
+	})
+}
+
+func Test029ExtractBoundsKeepsCollisionGroupsWhole(t *testing.T) {
+
+	cv.Convey("ExtractBounds should take or leave every frame sharing an endpoint timestamp, in insertion order", t, func() {
+
+		t0 := time.Date(2016, 2, 16, 0, 0, 0, 0, time.UTC)
+		pq := NewPriorityQueue()
+		// four frames at each of the seconds 0..4
+		for i := 0; i < 20; i++ {
+			f, err := tf.NewFrame(t0.Add(time.Duration(i%5)*time.Second), tf.EvTwo64, float64(i), int64(i), nil)
+			panicOn(err)
+			pq.Add(f)
+		}
+		t1 := t0.Add(time.Second)
+		t3 := t0.Add(3 * time.Second)
+
+		cv.So(pq.ExtractBounds(t1, Inclusive, t3, Exclusive), cv.ShouldHaveLength, 8)
+		cv.So(pq.Extract(t1, t3), cv.ShouldHaveLength, 8)
+		cv.So(pq.ExtractBounds(t1, Inclusive, t3, Inclusive), cv.ShouldHaveLength, 12)
+		cv.So(pq.ExtractBounds(t1, Exclusive, t3, Inclusive), cv.ShouldHaveLength, 8)
+		cv.So(pq.ExtractBounds(t1, Exclusive, t3, Exclusive), cv.ShouldHaveLength, 4)
+		cv.So(pq.ExtractBounds(t1, Inclusive, t1, Inclusive), cv.ShouldHaveLength, 4)
+		cv.So(pq.ExtractBounds(t1, Inclusive, t1, Exclusive), cv.ShouldHaveLength, 0)
+
+		got := pq.ExtractBounds(t3, Inclusive, t3, Inclusive)
+		for i := 1; i < len(got); i++ {
+			cv.So(got[i].GetV1() > got[i-1].GetV1(), cv.ShouldBeTrue)
+		}
+		cv.So(pq.Len(), cv.ShouldEqual, 20)
+	})
+}
+
+func Test030ValidateReportsFirstViolation(t *testing.T) {
+
+	cv.Convey("Validate should pass a healthy queue and describe a broken one, until Reinit repairs it", t, func() {
+
+		n := 30
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[(i*7)%n])
+		}
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+
+		pq.Seq[0].Idx = 5
+		cv.So(pq.Validate(), cv.ShouldNotBeNil)
+		pq.Seq[0].Idx = 0
+
+		// move the root to the back without telling the heap
+		last := len(pq.Seq) - 1
+		pq.Seq[0], pq.Seq[last] = pq.Seq[last], pq.Seq[0]
+		pq.Seq[0].Idx, pq.Seq[last].Idx = 0, last
+		err := pq.Validate()
+		cv.So(err, cv.ShouldNotBeNil)
+		cv.So(strings.Contains(err.Error(), "heap order"), cv.ShouldBeTrue)
+
+		pq.Reinit()
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+		for i := 0; i < n; i++ {
+			f, _ := pq.PopFrame()
+			cv.So(f, cv.ShouldEqual, frames[i])
+		}
+	})
+}
+
+func Test031NewPriorityQueueFromHeapifiesOnce(t *testing.T) {
+
+	cv.Convey("NewPriorityQueueFrom should yield a valid heap that pops the frames in order and keeps accepting Adds", t, func() {
+
+		n := 100
+		frames, _, _ := GenTestFrames(n, nil)
+		scrambled := make([]*tf.Frame, n)
+		for i := range frames {
+			scrambled[i] = frames[(i*37)%n]
+		}
+		pq := NewPriorityQueueFrom(scrambled[1:])
+		cv.So(pq.Len(), cv.ShouldEqual, n-1)
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+
+		pq.Add(scrambled[0])
+		for i := 0; i < n; i++ {
+			f, _ := pq.PopFrame()
+			cv.So(f, cv.ShouldEqual, frames[i])
+		}
+		cv.So(NewPriorityQueueFrom(nil).Len(), cv.ShouldEqual, 0)
+	})
+}
+
+func Test033PopUntilAndPopN(t *testing.T) {
+
+	cv.Convey("PopUntil should take every entry before the deadline and PopN a fixed count, both in pop order", t, func() {
+
+		n := 50
+		frames, tms, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[(i*11)%n])
+		}
+
+		batch := pq.PopUntil(tms[20])
+		cv.So(batch, cv.ShouldHaveLength, 20)
+		for i, pqe := range batch {
+			cv.So(pqe.Val, cv.ShouldEqual, frames[i])
+			cv.So(pqe.Idx, cv.ShouldEqual, -1)
+		}
+		cv.So(pq.PopUntil(tms[20]), cv.ShouldHaveLength, 0)
+
+		batch = pq.PopN(7)
+		cv.So(batch, cv.ShouldHaveLength, 7)
+		for i, pqe := range batch {
+			cv.So(pqe.Val, cv.ShouldEqual, frames[20+i])
+		}
+		cv.So(pq.PopN(100), cv.ShouldHaveLength, n-27)
+		cv.So(pq.PopN(1), cv.ShouldHaveLength, 0)
+		cv.So(pq.Len(), cv.ShouldEqual, 0)
+	})
+
+	cv.Convey("PopUntil under a custom LessFunc should still find every early entry and return it in LessFunc order", t, func() {
+
+		n := 30
+		frames, tms, _ := GenTestFrames(n, nil)
+		// latest first
+		pq := NewPriorityQueueWithLess(func(a, b *Pqe) bool { return a.OrderBy.After(b.OrderBy) })
+		for i := range frames {
+			pq.Add(frames[i])
+		}
+		batch := pq.PopUntil(tms[10])
+		cv.So(batch, cv.ShouldHaveLength, 10)
+		for i, pqe := range batch {
+			cv.So(pqe.Val, cv.ShouldEqual, frames[9-i])
+		}
+		cv.So(pq.Len(), cv.ShouldEqual, n-10)
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+	})
+}
+
+func Test036PeekNLeavesTheHeapAlone(t *testing.T) {
+
+	cv.Convey("PeekN should list the next n entries in pop order without changing the queue", t, func() {
+
+		n := 60
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewPriorityQueue()
+		for i := range frames {
+			pq.Add(frames[(i*17)%n])
+		}
+		before := append([]*Pqe(nil), pq.Seq...)
+
+		peek := pq.PeekN(25)
+		cv.So(peek, cv.ShouldHaveLength, 25)
+		for i, pqe := range peek {
+			cv.So(pqe.Val, cv.ShouldEqual, frames[i])
+		}
+		cv.So(pq.Seq, cv.ShouldResemble, before)
+		cv.So(pq.PeekN(0), cv.ShouldHaveLength, 0)
+		cv.So(pq.PeekN(1000), cv.ShouldHaveLength, n)
+
+		for i := 0; i < 25; i++ {
+			pqe, _ := pq.PopPqe()
+			cv.So(pqe, cv.ShouldEqual, peek[i])
+		}
+	})
+}
+
+func Test049RangeReflectsChanges(t *testing.T) {
+
+	for _, indexed := range []bool{false, true} {
+		cv.Convey(fmt.Sprintf("Range (indexed: %v) should list the entries in a window in time order, leave the heap alone, and see later changes", indexed), t, func() {
+
+			n := 60
+			frames, tms, _ := GenTestFrames(n, nil)
+			pq := NewPriorityQueue()
+			if indexed {
+				pq.EnableRangeIndex()
+			}
+			for i := range frames {
+				pq.Add(frames[(i*23)%n])
+			}
+			before := append([]*Pqe(nil), pq.Seq...)
+
+			got := pq.Range(tms[30], tms[41])
+			cv.So(got, cv.ShouldHaveLength, 11)
+			for i, pqe := range got {
+				cv.So(pqe.Val, cv.ShouldEqual, frames[30+i])
+			}
+			cv.So(pq.Seq, cv.ShouldResemble, before)
+			cv.So(pq.Range(tms[41], tms[30]), cv.ShouldHaveLength, 0)
+
+			pq.PopUntil(tms[35])
+			cv.So(pq.Range(tms[30], tms[41]), cv.ShouldHaveLength, 6)
+			pq.Add(frames[32])
+			got = pq.Range(tms[30], tms[41])
+			cv.So(got, cv.ShouldHaveLength, 7)
+			cv.So(got[0].Val, cv.ShouldEqual, frames[32])
+
+			// an Update moving an entry out of the window
+			pq.Update(got[0], frames[59])
+			cv.So(pq.Range(tms[30], tms[41]), cv.ShouldHaveLength, 6)
+			cv.So(pq.Validate(), cv.ShouldBeNil)
+		})
+	}
+
+	cv.Convey("the time index should track every way entries come and go, and agree with the heap walk", t, func() {
+
+		n := 200
+		frames, tms, _ := GenTestFrames(n, nil)
+		pq := NewBoundedPriorityQueue(120, EvictEarliest)
+		for i := 0; i < n/2; i++ {
+			pq.Add(frames[(i*37)%n])
+		}
+		pq.EnableRangeIndex()
+		plain := func() []*Pqe {
+			idx := pq.byTime
+			pq.byTime = nil
+			defer func() { pq.byTime = idx }()
+			return pq.Range(tms[20], tms[150])
+		}
+		for i := n / 2; i < n; i++ {
+			pq.Add(frames[(i*37)%n])
+			switch i % 5 {
+			case 0:
+				pq.PopFrame()
+			case 1:
+				heap.Remove(pq, pq.Len()/2)
+			case 2:
+				pq.Update(pq.Seq[pq.Len()-1], frames[i%n])
+			}
+			cv.So(pq.Validate(), cv.ShouldBeNil)
+		}
+		cv.So(pq.Range(tms[20], tms[150]), cv.ShouldResemble, plain())
+		cv.So(pq.Extract(tms[0], tms[n-1]), cv.ShouldHaveLength, pq.Len()-len(pq.Range(tms[n-1], tms[n-1].Add(time.Second))))
+	})
+}
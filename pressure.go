@@ -0,0 +1,148 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"math"
+	"runtime/metrics"
+)
+
+// MemoryPressure returns the memory the Go runtime holds from
+// the OS as a fraction of the process's soft memory limit
+// (GOMEMLIMIT, or debug.SetMemoryLimit), or 0 if no limit is
+// set. It is the default signal for a Degrader.
+func MemoryPressure() float64 {
+	s := []metrics.Sample{
+		{Name: "/gc/gomemlimit:bytes"},
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(s)
+	for _, x := range s {
+		if x.Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+	}
+	limit := s[0].Value.Uint64()
+	if limit == 0 || limit >= math.MaxInt64 {
+		return 0
+	}
+	used := s[1].Value.Uint64() - s[2].Value.Uint64()
+	return float64(used) / float64(limit)
+}
+
+// Degrader tightens a queue's limits while memory is short, and
+// restores them once it recovers. When Pressure reaches High,
+// MaxLen and every per-Evtnum budget are cut to Factor of their
+// value, so the queue's Policy and Evictor drop or evict sooner;
+// an unbounded queue is bounded at Factor of its current
+// length. When Pressure falls to Low, the saved limits come
+// back. The gap between High and Low keeps a signal hovering
+// near one threshold from flapping. Like SetEvtnumBudget,
+// tightening does not evict at once; it applies to later Adds.
+//
+// Call Check periodically, for example from a ticker. A
+// Degrader is not safe for concurrent use, and Check changes
+// the queue, so for a SyncPriorityQueue call it inside Do.
+type Degrader struct {
+	Pressure func() float64 // the signal; MemoryPressure if nil
+	High     float64
+	Low      float64
+	Factor   float64
+
+	// OnChange, if non-nil, is called whenever the queue is
+	// tightened or restored.
+	OnChange func(PressureEvent)
+
+	pq       *PriorityQueue
+	degraded bool
+	maxLen   int
+	budgets  map[tf.Evtnum]EvtnumBudget
+}
+
+// PressureEvent reports a Degrader tightening or restoring a
+// queue's limits.
+type PressureEvent struct {
+	Pressure float64 // the reading that triggered the change
+	Degraded bool    // true when tightening, false when restoring
+	MaxLen   int     // the queue's MaxLen afterwards
+}
+
+// NewDegrader returns a Degrader for pq that tightens at high
+// pressure to factor of the limits, and restores them at low.
+func NewDegrader(pq *PriorityQueue, high, low, factor float64) *Degrader {
+	return &Degrader{High: high, Low: low, Factor: factor, pq: pq}
+}
+
+// Degraded reports whether the queue's limits are tightened.
+func (d *Degrader) Degraded() bool {
+	return d.degraded
+}
+
+// Check samples the pressure signal, tightens or restores the
+// queue's limits if it has crossed a threshold, and reports
+// whether it changed them.
+func (d *Degrader) Check() bool {
+	pressure := d.Pressure
+	if pressure == nil {
+		pressure = MemoryPressure
+	}
+	p := pressure()
+	switch {
+	case !d.degraded && p >= d.High:
+		d.tighten()
+	case d.degraded && p <= d.Low:
+		d.restore()
+	default:
+		return false
+	}
+	if d.OnChange != nil {
+		d.OnChange(PressureEvent{Pressure: p, Degraded: d.degraded, MaxLen: d.pq.MaxLen})
+	}
+	return true
+}
+
+func (d *Degrader) tighten() {
+	pq := d.pq
+	d.maxLen = pq.MaxLen
+	bound := pq.MaxLen
+	if bound <= 0 {
+		bound = pq.Len()
+	}
+	pq.MaxLen = d.scale(int64(bound))
+	d.budgets = make(map[tf.Evtnum]EvtnumBudget, len(pq.ByEvtnum))
+	for ev, st := range pq.ByEvtnum {
+		if st.MaxCount <= 0 && st.MaxBytes <= 0 {
+			continue
+		}
+		d.budgets[ev] = EvtnumBudget{MaxCount: st.MaxCount, MaxBytes: st.MaxBytes}
+		if st.MaxCount > 0 {
+			st.MaxCount = int64(d.scale(st.MaxCount))
+		}
+		if st.MaxBytes > 0 {
+			st.MaxBytes = int64(d.scale(st.MaxBytes))
+		}
+	}
+	d.degraded = true
+}
+
+func (d *Degrader) restore() {
+	pq := d.pq
+	pq.MaxLen = d.maxLen
+	for ev, b := range d.budgets {
+		st := pq.evtnumStats(ev)
+		st.MaxCount = b.MaxCount
+		st.MaxBytes = b.MaxBytes
+	}
+	d.budgets = nil
+	d.degraded = false
+}
+
+// scale returns Factor of n, but never less than 1, since a
+// limit of 0 means unlimited.
+func (d *Degrader) scale(n int64) int {
+	v := int(float64(n) * d.Factor)
+	if v < 1 {
+		v = 1
+	}
+	return v
+}
@@ -0,0 +1,86 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"math"
+	"runtime/debug"
+	"testing"
+)
+
+func Test065DegraderTightensUnderPressure(t *testing.T) {
+
+	cv.Convey("a Degrader should cut the bound and budgets at high pressure, hold them between the thresholds, and restore them at low pressure", t, func() {
+
+		pq := NewBoundedPriorityQueue(100, EvictEarliest)
+		pq.SetEvtnumBudget(tf.EvTwo64, 10, 0)
+		pq.SetEvtnumBudget(tf.EvZero, 0, 4000)
+
+		p := 0.5
+		d := NewDegrader(pq, 0.9, 0.6, 0.5)
+		d.Pressure = func() float64 { return p }
+		var events []PressureEvent
+		d.OnChange = func(e PressureEvent) { events = append(events, e) }
+
+		cv.So(d.Check(), cv.ShouldBeFalse)
+
+		p = 0.95
+		cv.So(d.Check(), cv.ShouldBeTrue)
+		cv.So(d.Degraded(), cv.ShouldBeTrue)
+		cv.So(pq.MaxLen, cv.ShouldEqual, 50)
+		cv.So(pq.EvtnumStatsFor(tf.EvTwo64).MaxCount, cv.ShouldEqual, int64(5))
+		cv.So(pq.EvtnumStatsFor(tf.EvZero).MaxBytes, cv.ShouldEqual, int64(2000))
+		cv.So(pq.EvtnumStatsFor(tf.EvZero).MaxCount, cv.ShouldEqual, int64(0))
+
+		// between the thresholds nothing changes, either way.
+		p = 0.7
+		cv.So(d.Check(), cv.ShouldBeFalse)
+		cv.So(pq.MaxLen, cv.ShouldEqual, 50)
+
+		p = 0.6
+		cv.So(d.Check(), cv.ShouldBeTrue)
+		cv.So(d.Degraded(), cv.ShouldBeFalse)
+		cv.So(pq.MaxLen, cv.ShouldEqual, 100)
+		cv.So(pq.EvtnumStatsFor(tf.EvTwo64).MaxCount, cv.ShouldEqual, int64(10))
+		cv.So(pq.EvtnumStatsFor(tf.EvZero).MaxBytes, cv.ShouldEqual, int64(4000))
+
+		cv.So(events, cv.ShouldResemble, []PressureEvent{
+			{Pressure: 0.95, Degraded: true, MaxLen: 50},
+			{Pressure: 0.6, Degraded: false, MaxLen: 100},
+		})
+	})
+
+	cv.Convey("under pressure an unbounded queue should be bounded below its current length, and unbounded again afterwards", t, func() {
+
+		frames, _, _ := GenTestFrames(20, nil)
+		pq := NewPriorityQueue()
+		for _, f := range frames[:10] {
+			pq.Add(f)
+		}
+		p := 1.0
+		d := NewDegrader(pq, 0.9, 0.6, 0.5)
+		d.Pressure = func() float64 { return p }
+		cv.So(d.Check(), cv.ShouldBeTrue)
+		cv.So(pq.MaxLen, cv.ShouldEqual, 5)
+
+		_, err := pq.Add(frames[10])
+		cv.So(err, cv.ShouldEqual, ErrFull)
+
+		p = 0
+		d.Check()
+		cv.So(pq.MaxLen, cv.ShouldEqual, 0)
+		_, err = pq.Add(frames[10])
+		cv.So(err, cv.ShouldBeNil)
+	})
+
+	cv.Convey("MemoryPressure should report 0 without a memory limit, and the share of it in use with one", t, func() {
+		old := debug.SetMemoryLimit(math.MaxInt64)
+		defer debug.SetMemoryLimit(old)
+		cv.So(MemoryPressure(), cv.ShouldEqual, 0.0)
+
+		debug.SetMemoryLimit(1 << 40)
+		p := MemoryPressure()
+		cv.So(p, cv.ShouldBeGreaterThan, 0.0)
+		cv.So(p, cv.ShouldBeLessThan, 0.01)
+	})
+}
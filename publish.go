@@ -0,0 +1,99 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"sort"
+	"sync"
+)
+
+// Publisher maintains "latest N frames" caches, as a UI might
+// show, by mirroring every frame a queue releases into rings
+// written with WriteOverwrite: one global ring, and one ring
+// per key if key is set. Attach it with PublishTo, and every
+// frame the queue pops, by whichever method, or gives up to
+// Remove, is published; frames evicted by a bound or budget,
+// or moved by MoveUntil, are not.
+//
+// A Publisher has its own lock, so readers may call Latest
+// and LatestFor from any goroutine while the queue drains.
+type Publisher struct {
+	mu     sync.Mutex
+	n      int
+	key    func(f *tf.Frame) string
+	global *FrameRingBuf
+	byKey  map[string]*FrameRingBuf
+}
+
+// NewPublisher returns a Publisher keeping the latest n frames
+// overall and, if key is non-nil, the latest n frames for each
+// key. A ring is made for a key the first time it is seen.
+func NewPublisher(n int, key func(f *tf.Frame) string) *Publisher {
+	return &Publisher{
+		n:      n,
+		key:    key,
+		global: NewFrameRingBuf(n),
+		byKey:  make(map[string]*FrameRingBuf),
+	}
+}
+
+// PublishTo makes the queue publish each frame it pops to p.
+// A nil p detaches the current Publisher.
+func (pq *PriorityQueue) PublishTo(p *Publisher) {
+	pq.pub = p
+}
+
+// Publish records f as the latest frame, overall and for its key.
+func (p *Publisher) Publish(f *tf.Frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.global.WriteOverwrite([]*tf.Frame{f})
+	if p.key == nil {
+		return
+	}
+	k := p.key(f)
+	ring, ok := p.byKey[k]
+	if !ok {
+		ring = NewFrameRingBuf(p.n)
+		p.byKey[k] = ring
+	}
+	ring.WriteOverwrite([]*tf.Frame{f})
+}
+
+// Latest returns, oldest first, a copy of the latest frames
+// published.
+func (p *Publisher) Latest() []*tf.Frame {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ringCopy(p.global)
+}
+
+// LatestFor returns, oldest first, a copy of the latest frames
+// published under key, or nil if there were none.
+func (p *Publisher) LatestFor(key string) []*tf.Frame {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ring, ok := p.byKey[key]
+	if !ok {
+		return nil
+	}
+	return ringCopy(ring)
+}
+
+// Keys returns, sorted, the keys frames have been published under.
+func (p *Publisher) Keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]string, 0, len(p.byKey))
+	for k := range p.byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func ringCopy(ring *FrameRingBuf) []*tf.Frame {
+	first, second := ring.TwoContig(false)
+	res := make([]*tf.Frame, 0, len(first)+len(second))
+	res = append(res, first...)
+	return append(res, second...)
+}
@@ -0,0 +1,53 @@
+package pq
+
+import (
+	"fmt"
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+)
+
+func Test057PublisherMirrorsReleasedFrames(t *testing.T) {
+
+	cv.Convey("a Publisher should hold the latest n frames released, overall and per key, and nothing evicted or moved", t, func() {
+
+		n := 12
+		frames, tms, _ := GenTestFrames(n, nil)
+		byEv := func(f *tf.Frame) string { return fmt.Sprint(f.GetEvtnum()) }
+		pub := NewPublisher(3, byEv)
+
+		pq := NewBoundedPriorityQueue(10, EvictEarliest)
+		pq.PublishTo(pub)
+		for i := n - 1; i >= 0; i-- {
+			pq.Add(frames[i])
+		}
+		// frames 0 and 1 were refused by the bound, never released.
+		cv.So(pub.Latest(), cv.ShouldHaveLength, 0)
+
+		other := NewPriorityQueue()
+		moved, err := pq.MoveUntil(other, tms[4])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(moved, cv.ShouldEqual, 2)
+		cv.So(pub.Latest(), cv.ShouldHaveLength, 0)
+
+		var got []*tf.Frame
+		for f := range pq.Drain() {
+			got = append(got, f)
+			if len(got) == 5 {
+				break
+			}
+		}
+		cv.So(pub.Latest(), cv.ShouldResemble, frames[6:9])
+		cv.So(pq.Remove(pq.First()), cv.ShouldBeNil)
+		cv.So(pub.Latest(), cv.ShouldResemble, frames[7:10])
+
+		cv.So(pub.Keys(), cv.ShouldHaveLength, 3)
+		cv.So(pub.LatestFor(byEv(frames[0])), cv.ShouldResemble, []*tf.Frame{frames[6], frames[9]})
+		cv.So(pub.LatestFor(byEv(frames[1])), cv.ShouldResemble, []*tf.Frame{frames[4], frames[7]})
+		cv.So(pub.LatestFor("nope"), cv.ShouldBeNil)
+
+		pq.PublishTo(nil)
+		pq.PopFrame()
+		cv.So(pub.Latest(), cv.ShouldResemble, frames[7:10])
+	})
+}
@@ -0,0 +1,85 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"iter"
+	"os"
+	"time"
+)
+
+// Store is a tiny embedded time-series event store: history
+// lives in a day-partitioned archive under Dir (see
+// ArchiveSource), recent frames in the Live queue, and Query
+// reads both as one stream.
+type Store struct {
+	Dir  string
+	Live *SyncPriorityQueue
+}
+
+// NewStore returns a Store over the archive under dir and the
+// live queue, which may be nil for an archive-only store.
+func NewStore(dir string, live *SyncPriorityQueue) *Store {
+	return &Store{Dir: dir, Live: live}
+}
+
+// Query iterates, in time order, over the frames in [from, to)
+// for which pred returns true (every frame, if pred is nil),
+// whether they are archived or still queued. A frame that is
+// in both places, because it was archived but not yet dropped
+// from the queue, is yielded once, with FrameKey telling the
+// copies apart from distinct frames. The live queue is read
+// once, when iteration starts, and archived days as iteration
+// reaches them, so a frame moving from queue to archive
+// meanwhile is still seen. If Dir does not exist yet, only the
+// queue is read. Any error is yielded once, with a nil frame,
+// and ends the iteration.
+func (s *Store) Query(from, to time.Time, pred func(f *tf.Frame) bool) iter.Seq2[*tf.Frame, error] {
+	return func(yield func(*tf.Frame, error) bool) {
+		var recent []*tf.Frame
+		if s.Live != nil {
+			s.Live.Do(func(pq *PriorityQueue) {
+				recent = pq.Extract(from, to)
+			})
+		}
+		srcs := []FrameSource{&sliceSource{frames: recent}}
+		arch, err := NewArchiveSource(s.Dir, from, to)
+		switch {
+		case err == nil:
+			defer arch.Close()
+			srcs = append(srcs, arch)
+		case !os.IsNotExist(err):
+			yield(nil, err)
+			return
+		}
+
+		m := NewMerger(srcs...)
+		m.Key = FrameKey
+		for f, err := range Frames(m) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if pred != nil && !pred(f) {
+				continue
+			}
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
+
+// sliceSource yields already time-sorted frames from a slice.
+type sliceSource struct {
+	frames []*tf.Frame
+}
+
+func (s *sliceSource) NextFrame() (*tf.Frame, error) {
+	if len(s.frames) == 0 {
+		return nil, io.EOF
+	}
+	f := s.frames[0]
+	s.frames = s.frames[1:]
+	return f, nil
+}
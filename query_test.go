@@ -0,0 +1,91 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test055StoreQueryStitchesArchiveAndLive(t *testing.T) {
+
+	t0 := time.Date(2016, 2, 15, 0, 0, 0, 0, time.UTC)
+	at := func(h int, v float64) *tf.Frame {
+		f, err := tf.NewFrame(t0.Add(time.Duration(h)*time.Hour), tf.EvTwo64, v, int64(h), nil)
+		panicOn(err)
+		return f
+	}
+
+	cv.Convey("Query should serve archived and queued frames as one ordered stream, yielding a frame held in both places once", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-store")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+
+		writeArchive(dir, "a.tf", at(1, 0), at(5, 0))
+		writeArchive(dir, "a.tf", at(24+2, 0), at(24+6, 0), at(24+8, 0))
+
+		// the live queue still holds the last two archived frames,
+		// beside a distinct frame sharing one of their timestamps.
+		live := NewSyncPriorityQueue(nil)
+		for _, f := range []*tf.Frame{at(24+6, 0), at(24+8, 0), at(24+8, 1), at(24+9, 0), at(24+12, 0)} {
+			_, err := live.Add(f)
+			panicOn(err)
+		}
+		st := NewStore(dir, live)
+
+		type hv struct {
+			H int64
+			V float64
+		}
+		query := func(from, to time.Time, pred func(*tf.Frame) bool) []hv {
+			var got []hv
+			for f, err := range st.Query(from, to, pred) {
+				cv.So(err, cv.ShouldBeNil)
+				got = append(got, hv{f.GetV1(), f.GetV0()})
+			}
+			return got
+		}
+
+		cv.So(query(t0, t0.Add(48*time.Hour), nil), cv.ShouldResemble, []hv{
+			{1, 0}, {5, 0}, {24 + 2, 0}, {24 + 6, 0}, {24 + 8, 0}, {24 + 8, 1}, {24 + 9, 0}, {24 + 12, 0},
+		})
+		cv.So(query(t0.Add(4*time.Hour), t0.Add(24*time.Hour+9*time.Hour), nil), cv.ShouldResemble, []hv{
+			{5, 0}, {24 + 2, 0}, {24 + 6, 0}, {24 + 8, 0}, {24 + 8, 1},
+		})
+		odd := func(f *tf.Frame) bool { return f.GetV1()%2 == 1 }
+		cv.So(query(t0, t0.Add(48*time.Hour), odd), cv.ShouldResemble, []hv{
+			{1, 0}, {5, 0}, {24 + 9, 0},
+		})
+
+		// the query only reads the live queue.
+		cv.So(live.Len(), cv.ShouldEqual, 5)
+
+		n := 0
+		for range st.Query(t0, t0.Add(48*time.Hour), nil) {
+			n++
+			if n == 2 {
+				break
+			}
+		}
+		cv.So(n, cv.ShouldEqual, 2)
+	})
+
+	cv.Convey("Query over an archive directory not yet created should serve just the live queue", t, func() {
+
+		live := NewSyncPriorityQueue(nil)
+		_, err := live.Add(at(3, 0))
+		panicOn(err)
+		st := NewStore(filepath.Join(os.TempDir(), "pq-no-such-store"), live)
+
+		var got []int64
+		for f, err := range st.Query(t0, t0.Add(24*time.Hour), nil) {
+			cv.So(err, cv.ShouldBeNil)
+			got = append(got, f.GetV1())
+		}
+		cv.So(got, cv.ShouldResemble, []int64{3})
+	})
+}
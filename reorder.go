@@ -0,0 +1,181 @@
+package pq
+
+import (
+	"errors"
+	tf "github.com/glycerine/tmframe"
+	"time"
+)
+
+// ErrTooLate is returned by Reorderer.Add for a frame whose
+// timestamp is before a frame already released; emitting it
+// would break the output's time order.
+var ErrTooLate = errors.New("pq: frame arrived after the watermark passed it")
+
+// Reorderer accepts frames in any order and releases them in
+// timestamp order once the watermark has passed them. The
+// watermark trails the clock by Lateness: frames are held back
+// that long to give stragglers a chance to arrive.
+//
+// By default the clock is Now (time.Now unless replaced). If
+// EventTime is set, the clock is instead the latest frame
+// timestamp Added so far, which suits replays of recorded data.
+//
+// If MaxLatency is set, a frame held that long, by Now, is
+// released by the next Release even though the watermark has
+// not passed it, along with every held frame before it, so the
+// output stays in order. A straggler for that stretch is then
+// refused with ErrTooLate: strict ordering is traded for bounded
+// latency. EarlyReleases counts the frames so released.
+//
+// A Reorderer is not safe for concurrent use.
+type Reorderer struct {
+	Lateness  time.Duration
+	EventTime bool
+	Now       func() time.Time
+
+	MaxLatency time.Duration
+	Adaptive   *LatenessEstimator
+
+	Late          int64 // frames refused by Add with ErrTooLate
+	EarlyReleases int64 // frames released ahead of the watermark, per MaxLatency
+
+	pq       *PriorityQueue
+	maxSeen  time.Time
+	released time.Time // OrderBy of the last released frame
+	arrivals []arrival // held frames in arrival order, when MaxLatency is set
+}
+
+// arrival records when a frame with timestamp tm was Added.
+type arrival struct {
+	at time.Time
+	tm time.Time
+}
+
+// NewReorderer returns a Reorderer holding frames back by lateness.
+func NewReorderer(lateness time.Duration) *Reorderer {
+	return &Reorderer{
+		Lateness: lateness,
+		Now:      time.Now,
+		pq:       NewPriorityQueue(),
+	}
+}
+
+// Add queues f for release. A frame earlier than one already
+// released is refused with ErrTooLate and counted in Late.
+func (r *Reorderer) Add(f *tf.Frame) error {
+	return r.AddFrom(0, f)
+}
+
+// AddFrom is Add for a frame from source src, which only
+// matters to the Adaptive estimator.
+func (r *Reorderer) AddFrom(src int, f *tf.Frame) error {
+	tm := time.Unix(0, f.Tm())
+	if r.Adaptive != nil {
+		// refused frames count too: they show the lateness is short.
+		r.Adaptive.Observe(src, r.clock().Sub(tm))
+	}
+	if tm.Before(r.released) {
+		r.Late++
+		return ErrTooLate
+	}
+	if _, err := r.pq.Add(f); err != nil {
+		return err
+	}
+	if r.MaxLatency > 0 {
+		r.arrivals = append(r.arrivals, arrival{at: r.Now(), tm: tm})
+	}
+	if tm.After(r.maxSeen) {
+		r.maxSeen = tm
+	}
+	return nil
+}
+
+// Watermark returns the time before which frames are released.
+func (r *Reorderer) Watermark() time.Time {
+	return r.clock().Add(-r.lateness())
+}
+
+// clock returns the time the watermark trails.
+func (r *Reorderer) clock() time.Time {
+	if r.EventTime {
+		return r.maxSeen
+	}
+	return r.Now()
+}
+
+// lateness returns the Adaptive estimate if there is one,
+// otherwise Lateness.
+func (r *Reorderer) lateness() time.Duration {
+	if r.Adaptive != nil {
+		if d, ok := r.Adaptive.Lateness(); ok {
+			return d
+		}
+	}
+	return r.Lateness
+}
+
+// Release pops, in timestamp order, every held frame that
+// is before the watermark, or is due under MaxLatency.
+func (r *Reorderer) Release() []*tf.Frame {
+	return r.releaseBefore(r.Watermark(), false)
+}
+
+// Flush pops every held frame, in timestamp order,
+// regardless of the watermark.
+func (r *Reorderer) Flush() []*tf.Frame {
+	return r.releaseBefore(time.Time{}, true)
+}
+
+// Len returns the number of frames being held.
+func (r *Reorderer) Len() int {
+	return r.pq.Len()
+}
+
+// NextRelease returns the time at which the earliest held
+// frame will become releasable under the wall clock, or a held
+// frame will reach MaxLatency if that is sooner, and false if
+// nothing is held.
+func (r *Reorderer) NextRelease() (time.Time, bool) {
+	if r.pq.Len() == 0 {
+		return time.Time{}, false
+	}
+	next := r.pq.First().OrderBy.Add(r.lateness())
+	if len(r.arrivals) > 0 {
+		if due := r.arrivals[0].at.Add(r.MaxLatency); due.Before(next) {
+			next = due
+		}
+	}
+	return next, true
+}
+
+func (r *Reorderer) releaseBefore(wm time.Time, all bool) []*tf.Frame {
+	// frames up to cutoff are due under MaxLatency.
+	var cutoff time.Time
+	due := false
+	if all {
+		r.arrivals = nil
+	} else if len(r.arrivals) > 0 {
+		now := r.Now()
+		for len(r.arrivals) > 0 && now.Sub(r.arrivals[0].at) >= r.MaxLatency {
+			if !due || r.arrivals[0].tm.After(cutoff) {
+				cutoff = r.arrivals[0].tm
+				due = true
+			}
+			r.arrivals = r.arrivals[1:]
+		}
+	}
+	var res []*tf.Frame
+	for r.pq.Len() > 0 {
+		head := r.pq.First()
+		if !all && !head.OrderBy.Before(wm) {
+			if !due || head.OrderBy.After(cutoff) {
+				break
+			}
+			r.EarlyReleases++
+		}
+		r.pq.PopPqe()
+		r.released = head.OrderBy
+		res = append(res, head.Val)
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+	"time"
+)
+
+func Test016ReordererReleasesBehindTheWatermark(t *testing.T) {
+
+	cv.Convey("a Reorderer should hold jittered frames until the watermark passes, then emit them in order", t, func() {
+
+		n := 30
+		frames, tms, _ := GenTestFrames(n, nil)
+
+		r := NewReorderer(5 * time.Second)
+		var now time.Time
+		r.Now = func() time.Time { return now }
+
+		// frames arrive in pairs swapped, one second after their timestamps.
+		var out []*tf.Frame
+		for i := 0; i+1 < n; i += 2 {
+			now = tms[i+1].Add(time.Second)
+			cv.So(r.Add(frames[i+1]), cv.ShouldBeNil)
+			cv.So(r.Add(frames[i]), cv.ShouldBeNil)
+			out = append(out, r.Release()...)
+		}
+		cv.So(len(out), cv.ShouldBeLessThanOrEqualTo, n-4)
+		out = append(out, r.Flush()...)
+		cv.So(out, cv.ShouldResemble, frames)
+
+		// anything earlier than the last release is now too late.
+		cv.So(r.Add(frames[0]), cv.ShouldEqual, ErrTooLate)
+		cv.So(r.Late, cv.ShouldEqual, int64(1))
+	})
+
+	cv.Convey("in EventTime mode the watermark follows the latest timestamp seen", t, func() {
+
+		frames, _, _ := GenTestFrames(10, nil)
+		r := NewReorderer(3 * time.Second)
+		r.EventTime = true
+		for i := range frames {
+			r.Add(frames[i])
+		}
+		out := r.Release()
+		cv.So(out, cv.ShouldResemble, frames[:6])
+		cv.So(r.Len(), cv.ShouldEqual, 4)
+	})
+}
+
+func Test062ReordererLatencyBudget(t *testing.T) {
+
+	cv.Convey("with MaxLatency, a frame held that long should be released ahead of the watermark, with everything before it, and counted", t, func() {
+
+		t0 := time.Date(2016, 2, 15, 0, 0, 0, 0, time.UTC)
+		at := func(ms int) *tf.Frame {
+			f, err := tf.NewFrame(t0.Add(time.Duration(ms)*time.Millisecond), tf.EvTwo64, 0, int64(ms), nil)
+			panicOn(err)
+			return f
+		}
+		r := NewReorderer(10 * time.Second)
+		r.MaxLatency = 2 * time.Second
+		now := t0
+		r.Now = func() time.Time { return now }
+
+		a, b, c := at(1000), at(0), at(5000)
+		cv.So(r.Add(a), cv.ShouldBeNil)
+		now = t0.Add(1500 * time.Millisecond)
+		cv.So(r.Add(b), cv.ShouldBeNil)
+		cv.So(r.Add(c), cv.ShouldBeNil)
+
+		now = t0.Add(1999 * time.Millisecond)
+		cv.So(r.Release(), cv.ShouldHaveLength, 0)
+
+		// a is due; b, earlier, goes with it; c waits.
+		now = t0.Add(2 * time.Second)
+		cv.So(r.Release(), cv.ShouldResemble, []*tf.Frame{b, a})
+		cv.So(r.EarlyReleases, cv.ShouldEqual, int64(2))
+		cv.So(r.Len(), cv.ShouldEqual, 1)
+
+		// a straggler for the released stretch is now too late.
+		cv.So(r.Add(at(500)), cv.ShouldEqual, ErrTooLate)
+
+		next, ok := r.NextRelease()
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(next, cv.ShouldResemble, t0.Add(3500*time.Millisecond))
+		now = next
+		cv.So(r.Release(), cv.ShouldResemble, []*tf.Frame{c})
+		cv.So(r.EarlyReleases, cv.ShouldEqual, int64(3))
+
+		// without a budget nothing is released early.
+		r.MaxLatency = 0
+		cv.So(r.Add(at(6000)), cv.ShouldBeNil)
+		now = now.Add(5 * time.Second)
+		cv.So(r.Release(), cv.ShouldHaveLength, 0)
+		cv.So(r.EarlyReleases, cv.ShouldEqual, int64(3))
+	})
+}
@@ -0,0 +1,46 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"time"
+)
+
+// Replay reads the tmframe stream in r, queues its frames, and
+// sends them to out in time order, paced so that the gaps between
+// sends are the gaps between timestamps divided by speed: 1.0 is
+// realtime, 10 is ten times faster, and 0 (or less) sends as fast
+// as out will take them. Sends are scheduled against the start of
+// the replay, so slow receivers do not make the pacing drift.
+//
+// The whole stream is queued before the first send, so frames
+// need not be sorted in r, at the cost of holding them all in
+// memory. Replay closes out when done, and returns any error
+// reading r; nothing is sent in that case.
+func Replay(r io.Reader, speed float64, out chan<- *tf.Frame) error {
+	defer close(out)
+	var frames []*tf.Frame
+	for f, err := range ReadFrames(r) {
+		if err != nil {
+			return err
+		}
+		frames = append(frames, f)
+	}
+	pq := NewPriorityQueueFrom(frames)
+	if pq.Len() == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	t0 := pq.First().OrderBy
+	for f := range pq.Drain() {
+		if speed > 0 {
+			offset := time.Duration(float64(f.Tm()-t0.UnixNano()) / speed)
+			if d := time.Until(start.Add(offset)); d > 0 {
+				time.Sleep(d)
+			}
+		}
+		out <- f
+	}
+	return nil
+}
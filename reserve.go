@@ -0,0 +1,88 @@
+package pq
+
+import (
+	"errors"
+	tf "github.com/glycerine/tmframe"
+)
+
+// ErrReservationDone is returned by Commit on a Reservation
+// that has already been committed or aborted.
+var ErrReservationDone = errors.New("pq: reservation already committed or aborted")
+
+// ErrOverReservation is returned by Commit when given more
+// frames than were reserved.
+var ErrOverReservation = errors.New("pq: more frames than reserved")
+
+// A Reservation holds room in a bounded queue for frames that
+// have not been built yet. Until it is committed or aborted,
+// Add treats the reserved slots as occupied. Like the queue
+// itself, a Reservation does no locking.
+type Reservation struct {
+	pq   *PriorityQueue
+	n    int
+	done bool
+}
+
+// Reserve sets aside room for n frames, so a producer can
+// find out before building an expensive batch whether it will
+// fit. It returns ErrFull if fewer than n slots are free;
+// reserving never evicts. On an unbounded queue (MaxLen <= 0)
+// Reserve always succeeds.
+func (pq *PriorityQueue) Reserve(n int) (*Reservation, error) {
+	if n < 0 {
+		n = 0
+	}
+	if pq.MaxLen > 0 {
+		if len(pq.Seq)+pq.reserved+n > pq.MaxLen {
+			return nil, ErrFull
+		}
+		pq.reserved += n
+	}
+	return &Reservation{pq: pq, n: n}, nil
+}
+
+// Len returns the number of slots reserved.
+func (r *Reservation) Len() int {
+	return r.n
+}
+
+// Commit adds frames to the queue into the reserved room and
+// releases any slots left unused. If there are more frames than
+// slots, Commit returns ErrOverReservation and adds nothing,
+// leaving the reservation open. Frames may still be refused by
+// per-Evtnum budgets; Commit adds the rest and returns the
+// first such error. The returned entries are those added.
+func (r *Reservation) Commit(frames []*tf.Frame) ([]*Pqe, error) {
+	if r.done {
+		return nil, ErrReservationDone
+	}
+	if len(frames) > r.n {
+		return nil, ErrOverReservation
+	}
+	r.Abort()
+	var first error
+	added := make([]*Pqe, 0, len(frames))
+	for _, f := range frames {
+		pqe, err := r.pq.Add(f)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		added = append(added, pqe)
+	}
+	return added, first
+}
+
+// Abort releases the reserved slots without adding anything.
+// It is safe to call more than once, and after Commit.
+func (r *Reservation) Abort() {
+	if r.done {
+		return
+	}
+	r.done = true
+	if r.pq.MaxLen > 0 {
+		r.pq.reserved -= r.n
+	}
+}
@@ -0,0 +1,70 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"os"
+	"time"
+)
+
+// FileSummary describes the contents of a tmframe file:
+// how many frames it holds, the time span they cover, and
+// how many of each Evtnum were seen.
+type FileSummary struct {
+	Path         string
+	Count        int64
+	Bytes        int64
+	First        time.Time
+	Last         time.Time
+	EvtnumCounts map[tf.Evtnum]int64
+
+	// Truncated is set when the scan stopped at its frame cap
+	// before reaching the end of the file; then Count, Last,
+	// and EvtnumCounts describe only the frames scanned.
+	Truncated bool
+}
+
+// QuickScan reads the tmframe file at path once, without
+// retaining any frames, and summarizes it.
+func QuickScan(path string) (*FileSummary, error) {
+	return QuickScanCapped(path, 0)
+}
+
+// QuickScanCapped is QuickScan, but stops after maxFrames
+// frames when maxFrames > 0, setting Truncated if frames remained.
+func QuickScanCapped(path string, maxFrames int64) (*FileSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sum := &FileSummary{
+		Path:         path,
+		EvtnumCounts: make(map[tf.Evtnum]int64),
+	}
+	fr := tf.NewFrameReader(f, DefaultMaxFrameBytes)
+	var frame tf.Frame
+	for {
+		if maxFrames > 0 && sum.Count >= maxFrames {
+			_, _, err, _ = fr.NextFrame(&frame)
+			sum.Truncated = (err == nil)
+			return sum, nil
+		}
+		_, nbytes, err, _ := fr.NextFrame(&frame)
+		if err == io.EOF {
+			return sum, nil
+		}
+		if err != nil {
+			return sum, err
+		}
+		tm := time.Unix(0, frame.Tm())
+		if sum.Count == 0 {
+			sum.First = tm
+		}
+		sum.Last = tm
+		sum.Count++
+		sum.Bytes += nbytes
+		sum.EvtnumCounts[frame.GetEvtnum()]++
+	}
+}
@@ -0,0 +1,39 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test006QuickScanSummarizesAFile(t *testing.T) {
+
+	cv.Convey("QuickScan should report the count, time span, and Evtnum breakdown of a file", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-scan")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "scan.tf")
+
+		n := 30
+		_, tms, by := GenTestFrames(n, &path)
+
+		sum, err := QuickScan(path)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(sum.Count, cv.ShouldEqual, int64(n))
+		cv.So(sum.Bytes, cv.ShouldEqual, int64(len(by)))
+		cv.So(sum.First.Equal(tms[0]), cv.ShouldBeTrue)
+		cv.So(sum.Last.Equal(tms[n-1]), cv.ShouldBeTrue)
+		cv.So(sum.EvtnumCounts[tf.EvZero], cv.ShouldEqual, int64(n/3))
+		cv.So(sum.Truncated, cv.ShouldBeFalse)
+
+		capped, err := QuickScanCapped(path, 5)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(capped.Count, cv.ShouldEqual, int64(5))
+		cv.So(capped.Last.Equal(tms[4]), cv.ShouldBeTrue)
+		cv.So(capped.Truncated, cv.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,149 @@
+package pq
+
+import (
+	"errors"
+	tf "github.com/glycerine/tmframe"
+	"sync"
+	"time"
+)
+
+// ErrSchedulerStopped is returned by Scheduler.Add after Stop.
+var ErrSchedulerStopped = errors.New("pq: scheduler stopped")
+
+// Scheduler delivers frames at the wall-clock time given by
+// their timestamps, turning a PriorityQueue into a delay queue
+// for frame replay. A single timer is kept, armed for the head
+// of the queue; frames already due when added are delivered at
+// once. Add may be called from any goroutine.
+//
+// Deliveries happen in time order on the Scheduler's own
+// goroutine; a slow deliver func delays later frames rather
+// than reordering them.
+type Scheduler struct {
+	mu      sync.Mutex
+	pq      *PriorityQueue
+	deliver func(f *tf.Frame)
+	wake    chan struct{}
+	done    chan struct{}
+	exited  chan struct{}
+	stopped bool
+}
+
+// NewScheduler starts a Scheduler that calls deliver with each
+// frame once its time has come. To deliver to a channel, pass
+// func(f *tf.Frame) { ch <- f }.
+func NewScheduler(deliver func(f *tf.Frame)) *Scheduler {
+	s := &Scheduler{
+		pq:      NewPriorityQueue(),
+		deliver: deliver,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Add schedules f for delivery at f.Tm().
+func (s *Scheduler) Add(f *tf.Frame) error {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return ErrSchedulerStopped
+	}
+	pqe, err := s.pq.Add(f)
+	head := err == nil && pqe.Idx == 0
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if head {
+		// new head: re-arm the timer.
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Len returns the number of frames waiting for their time.
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pq.Len()
+}
+
+// Stop halts delivery, waits for an in-progress delivery to
+// finish, and returns the frames that were never delivered,
+// in time order.
+func (s *Scheduler) Stop() []*tf.Frame {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	s.mu.Unlock()
+	close(s.done)
+	<-s.exited
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var left []*tf.Frame
+	for f := range s.pq.Drain() {
+		left = append(left, f)
+	}
+	return left
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.exited)
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		due := s.pq.PopUntil(now.Add(1))
+		wait := time.Duration(-1)
+		if s.pq.Len() > 0 {
+			wait = s.pq.First().OrderBy.Sub(now)
+		}
+		s.mu.Unlock()
+
+		for k, pqe := range due {
+			select {
+			case <-s.done:
+				// put the undelivered back for Stop to return.
+				s.mu.Lock()
+				for _, rest := range due[k:] {
+					s.pq.Add(rest.Val)
+				}
+				s.mu.Unlock()
+				return
+			default:
+			}
+			s.deliver(pqe.Val)
+		}
+		if len(due) > 0 {
+			continue
+		}
+
+		var fire <-chan time.Time
+		var timer *time.Timer
+		if wait >= 0 {
+			timer = time.NewTimer(wait)
+			fire = timer.C
+		}
+		select {
+		case <-fire:
+		case <-s.wake:
+		case <-s.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
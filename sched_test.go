@@ -0,0 +1,41 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tf "github.com/glycerine/tmframe"
+	"testing"
+	"time"
+)
+
+func Test038SchedulerDeliversOnTime(t *testing.T) {
+
+	cv.Convey("a Scheduler should deliver frames in time order, no earlier than their timestamps", t, func() {
+
+		out := make(chan *tf.Frame, 10)
+		s := NewScheduler(func(f *tf.Frame) { out <- f })
+
+		t0 := time.Now()
+		offsets := []int{60, 20, 0, 40}
+		for _, ms := range offsets {
+			f, err := tf.NewFrame(t0.Add(time.Duration(ms)*time.Millisecond), tf.EvZero, 0, 0, nil)
+			panicOn(err)
+			cv.So(s.Add(f), cv.ShouldBeNil)
+		}
+
+		prev := int64(0)
+		for range offsets {
+			f := <-out
+			cv.So(time.Now().UnixNano() >= f.Tm(), cv.ShouldBeTrue)
+			cv.So(f.Tm() >= prev, cv.ShouldBeTrue)
+			prev = f.Tm()
+		}
+		cv.So(s.Len(), cv.ShouldEqual, 0)
+
+		later, err := tf.NewFrame(time.Now().Add(time.Hour), tf.EvZero, 0, 0, nil)
+		panicOn(err)
+		s.Add(later)
+		left := s.Stop()
+		cv.So(left, cv.ShouldResemble, []*tf.Frame{later})
+		cv.So(s.Add(later), cv.ShouldEqual, ErrSchedulerStopped)
+	})
+}
@@ -0,0 +1,116 @@
+package pq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"sort"
+)
+
+// ErrBadSnapshot is returned by LoadPriorityQueue when the
+// stream does not begin with a queue snapshot header.
+var ErrBadSnapshot = errors.New("pq: not a PriorityQueue snapshot")
+
+const (
+	// maxSnapshotCount bounds the entry count LoadPriorityQueue
+	// will believe; anything larger marks a corrupt header.
+	maxSnapshotCount = 1 << 40
+
+	// snapshotPrealloc caps the frames preallocated on load.
+	snapshotPrealloc = 1 << 16
+)
+
+var snapshotMagic = [8]byte{'p', 'q', 's', 'n', 'a', 'p', '0', '1'}
+
+// snapshotHeader precedes the frames in a snapshot. It is
+// written little-endian with encoding/binary.
+type snapshotHeader struct {
+	Magic      [8]byte
+	Count      int64
+	MaxLen     int64
+	Policy     int32
+	StableTies uint8
+	_          [3]byte
+}
+
+// Marshal writes a snapshot of the queue to w: a fixed header
+// carrying the entry count and the queue's bound, policy, and
+// tie-breaking settings, followed by the queued frames as an
+// ordinary tmframe stream in pop order. The queue is not
+// modified.
+//
+// Functions cannot be persisted: LessFunc, SizeFunc, Evictor,
+// Journal, and per-Evtnum budgets must be set again after loading.
+func (pq *PriorityQueue) Marshal(w io.Writer) error {
+	ordered := make([]*Pqe, len(pq.Seq))
+	copy(ordered, pq.Seq)
+	sort.SliceStable(ordered, func(i, j int) bool { return pq.less(ordered[i], ordered[j]) })
+
+	hdr := snapshotHeader{
+		Magic:  snapshotMagic,
+		Count:  int64(len(ordered)),
+		MaxLen: int64(pq.MaxLen),
+		Policy: int32(pq.Policy),
+	}
+	if pq.StableTies {
+		hdr.StableTies = 1
+	}
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+	var buf []byte
+	var err error
+	for _, pqe := range ordered {
+		buf, err = pqe.Val.Marshal(buf[:0])
+		if err != nil {
+			return err
+		}
+		if _, err = bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LoadPriorityQueue reads a snapshot written by Marshal and
+// returns a queue holding the same frames, with the same bound,
+// policy, and tie-breaking; equal-timestamp frames keep their
+// relative order.
+func LoadPriorityQueue(r io.Reader) (*PriorityQueue, error) {
+	var hdr snapshotHeader
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrBadSnapshot
+		}
+		return nil, err
+	}
+	if hdr.Magic != snapshotMagic || hdr.Count < 0 || hdr.Count > maxSnapshotCount {
+		return nil, ErrBadSnapshot
+	}
+
+	// the header is not trusted to size allocations; a false
+	// Count shows up as a short stream instead.
+	fr := tf.NewFrameReader(r, DefaultMaxFrameBytes)
+	frames := make([]*tf.Frame, 0, intMin(int(hdr.Count), snapshotPrealloc))
+	for i := int64(0); i < hdr.Count; i++ {
+		var frame tf.Frame
+		_, _, err, _ := fr.NextFrame(&frame)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("pq: snapshot frame %d of %d: %v", i, hdr.Count, err)
+		}
+		frames = append(frames, &frame)
+	}
+
+	pq := NewPriorityQueueFrom(frames)
+	pq.MaxLen = int(hdr.MaxLen)
+	pq.Policy = EvictPolicy(hdr.Policy)
+	pq.StableTies = hdr.StableTies != 0
+	return pq, nil
+}
@@ -0,0 +1,49 @@
+package pq
+
+import (
+	"bytes"
+	"encoding/binary"
+	cv "github.com/glycerine/goconvey/convey"
+	"testing"
+)
+
+func Test028SnapshotRoundTrip(t *testing.T) {
+
+	cv.Convey("a queue written with Marshal should load back with the same frames, order, and settings", t, func() {
+
+		n := 40
+		frames, _, _ := GenTestFrames(n, nil)
+		pq := NewBoundedPriorityQueue(100, EvictLatest)
+		for i := range frames {
+			pq.Add(frames[(i*13)%n])
+		}
+		var buf bytes.Buffer
+		cv.So(pq.Marshal(&buf), cv.ShouldBeNil)
+		cv.So(pq.Len(), cv.ShouldEqual, n)
+
+		back, err := LoadPriorityQueue(&buf)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(back.Len(), cv.ShouldEqual, n)
+		cv.So(back.MaxLen, cv.ShouldEqual, 100)
+		cv.So(back.Policy, cv.ShouldEqual, EvictLatest)
+		cv.So(back.StableTies, cv.ShouldBeTrue)
+		for i := 0; i < n; i++ {
+			f, _ := back.PopFrame()
+			cv.So(f.Tm(), cv.ShouldEqual, frames[i].Tm())
+		}
+
+		_, err = LoadPriorityQueue(bytes.NewReader([]byte("definitely not a snapshot")))
+		cv.So(err, cv.ShouldEqual, ErrBadSnapshot)
+
+		// a hostile Count must not size any allocation.
+		var hostile bytes.Buffer
+		binary.Write(&hostile, binary.LittleEndian, &snapshotHeader{Magic: snapshotMagic, Count: 1 << 62})
+		_, err = LoadPriorityQueue(&hostile)
+		cv.So(err, cv.ShouldEqual, ErrBadSnapshot)
+
+		var short bytes.Buffer
+		binary.Write(&short, binary.LittleEndian, &snapshotHeader{Magic: snapshotMagic, Count: 1 << 30})
+		_, err = LoadPriorityQueue(&short)
+		cv.So(err, cv.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,102 @@
+package pq
+
+import (
+	"bufio"
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"time"
+)
+
+// SortingWriter is an io.Writer for a raw marshalled tmframe
+// stream that is only mildly out of order. It parses the bytes
+// written to it into frames, holds them in a Reorderer for up to
+// Window of event time, and writes them to the underlying writer
+// in timestamp order. Frames may be split across Writes in any
+// way. Frames arriving more than Window behind the latest frame
+// seen cannot be put back in order; they are dropped and counted
+// in Late.
+//
+// Close must be called to flush the frames still held. Errors
+// parsing the input or writing the output are returned by the
+// Write or Close that follows them.
+type SortingWriter struct {
+	Window time.Duration
+
+	// Late counts frames dropped for arriving too late.
+	// Read it only after Close.
+	Late int64
+
+	pw   *io.PipeWriter
+	done chan struct{}
+	err  error
+}
+
+// NewSortingWriter returns a SortingWriter writing to w with
+// the given lateness window.
+func NewSortingWriter(w io.Writer, window time.Duration) *SortingWriter {
+	pr, pw := io.Pipe()
+	s := &SortingWriter{
+		Window: window,
+		pw:     pw,
+		done:   make(chan struct{}),
+	}
+	go s.sort(pr, w)
+	return s
+}
+
+// Write parses p as more of the frame stream.
+func (s *SortingWriter) Write(p []byte) (int, error) {
+	return s.pw.Write(p)
+}
+
+// Close ends the input, writes out every frame still held, and
+// returns the first error met, if any.
+func (s *SortingWriter) Close() error {
+	s.pw.Close()
+	<-s.done
+	return s.err
+}
+
+func (s *SortingWriter) sort(pr *io.PipeReader, w io.Writer) {
+	defer close(s.done)
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	emit := func(frames []*tf.Frame) error {
+		var err error
+		for _, f := range frames {
+			buf, err = f.Marshal(buf[:0])
+			if err != nil {
+				return err
+			}
+			if _, err = bw.Write(buf); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+
+	r := NewReorderer(s.Window)
+	r.EventTime = true
+	src := NewReaderSource(pr)
+	for {
+		f, err := src.NextFrame()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			if r.Add(f) == nil {
+				err = emit(r.Release())
+			}
+		}
+		if err != nil {
+			s.err = err
+			pr.CloseWithError(err)
+			return
+		}
+	}
+	s.Late = r.Late
+	if err := emit(r.Flush()); err != nil {
+		s.err = err
+	}
+	pr.Close()
+}
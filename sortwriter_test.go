@@ -0,0 +1,49 @@
+package pq
+
+import (
+	"bytes"
+	cv "github.com/glycerine/goconvey/convey"
+	"testing"
+)
+
+func Test040SortingWriterFixesMildDisorder(t *testing.T) {
+
+	cv.Convey("bytes of a mildly out-of-order stream, written in odd-sized pieces, should come out sorted", t, func() {
+
+		n := 40
+		frames, tms, sorted := GenTestFrames(n, nil)
+		var in bytes.Buffer
+		// swap neighbours, and push one frame far too late
+		for i := 0; i < n; i += 2 {
+			for _, j := range []int{i + 1, i} {
+				if j == 5 {
+					continue
+				}
+				by, err := frames[j].Marshal(nil)
+				panicOn(err)
+				in.Write(by)
+			}
+		}
+		late, err := frames[5].Marshal(nil)
+		panicOn(err)
+		in.Write(late)
+
+		var out bytes.Buffer
+		sw := NewSortingWriter(&out, tms[3].Sub(tms[0]))
+		raw := in.Bytes()
+		for len(raw) > 0 {
+			k := 7
+			if k > len(raw) {
+				k = len(raw)
+			}
+			_, err := sw.Write(raw[:k])
+			cv.So(err, cv.ShouldBeNil)
+			raw = raw[k:]
+		}
+		cv.So(sw.Close(), cv.ShouldBeNil)
+		cv.So(sw.Late, cv.ShouldEqual, int64(1))
+
+		want := bytes.Replace(sorted, late, nil, 1)
+		cv.So(bytes.Equal(out.Bytes(), want), cv.ShouldBeTrue)
+	})
+}
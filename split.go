@@ -0,0 +1,67 @@
+package pq
+
+import (
+	"errors"
+	tf "github.com/glycerine/tmframe"
+	"hash/fnv"
+	"time"
+)
+
+// ErrBucketWidth is returned by ByTimeBucket for a bucket
+// width that is not positive.
+var ErrBucketWidth = errors.New("pq: time bucket width must be positive")
+
+// A Partitioner maps a frame to one of n partitions, returning
+// an index in [0, n).
+type Partitioner func(f *tf.Frame, n int) int
+
+// ByTimeBucket partitions by time: consecutive buckets of
+// width d go to consecutive partitions, round robin, so with
+// d = time.Minute and two partitions alternate minutes go to
+// alternate outputs. A d <= 0 is refused with ErrBucketWidth.
+func ByTimeBucket(d time.Duration) (Partitioner, error) {
+	if d <= 0 {
+		return nil, ErrBucketWidth
+	}
+	return func(f *tf.Frame, n int) int {
+		b := f.Tm() / int64(d)
+		i := int(b % int64(n))
+		if i < 0 {
+			i += n
+		}
+		return i
+	}, nil
+}
+
+// ByKeyHash partitions by an FNV-1a hash of key(f), so all
+// frames with the same key go to the same partition.
+func ByKeyHash(key func(f *tf.Frame) string) Partitioner {
+	return func(f *tf.Frame, n int) int {
+		h := fnv.New32a()
+		h.Write([]byte(key(f)))
+		return int(h.Sum32() % uint32(n))
+	}
+}
+
+// SplitChans is the inverse of MergeChans: it receives the
+// time-sorted stream in until in is closed, sending each frame
+// to outs[part(f, len(outs))], and closes every out when done.
+// Each out receives a time-sorted sub-stream, so parallel
+// downstream loaders each see frames in order. A slow out
+// holds up the others, since order is kept per partition by
+// sending in input order.
+func SplitChans(in <-chan *tf.Frame, part Partitioner, outs ...chan<- *tf.Frame) {
+	defer func() {
+		for _, out := range outs {
+			close(out)
+		}
+	}()
+	if len(outs) == 0 {
+		for range in {
+		}
+		return
+	}
+	for f := range in {
+		outs[part(f, len(outs))] <- f
+	}
+}
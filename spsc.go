@@ -0,0 +1,110 @@
+package pq
+
+import (
+	tm "github.com/glycerine/tmframe"
+	"io"
+	"sync/atomic"
+)
+
+// SPSCRingBuf is a lock-free ring for exactly one writing
+// goroutine and one reading goroutine, such as a network reader
+// handing frames to a sorter. Each side owns one index and only
+// reads the other's, so neither ever blocks or takes a lock.
+// Its read and write methods match RingBuf's: a full ring
+// short-writes and an empty one reads io.EOF, and callers spin,
+// yield, or back off as suits their hot path.
+//
+// Using it from more than one writer or more than one reader at
+// a time is a data race.
+type SPSCRingBuf[T any] struct {
+	a    []T
+	mask uint64
+
+	// head and tail count elements ever read and written; they
+	// sit on separate cache lines so the two sides do not
+	// contend for one.
+	_    [64]byte
+	head atomic.Uint64
+	_    [56]byte
+	tail atomic.Uint64
+	_    [56]byte
+}
+
+// SPSCFrameRingBuf is an SPSCRingBuf of *tm.Frame.
+type SPSCFrameRingBuf = SPSCRingBuf[*tm.Frame]
+
+// NewSPSCRingBuf returns an SPSCRingBuf holding at least maxSize
+// elements; the size is rounded up to a power of two so that
+// indexing is a mask rather than a division.
+func NewSPSCRingBuf[T any](maxSize int) *SPSCRingBuf[T] {
+	n := 1
+	for n < maxSize {
+		n <<= 1
+	}
+	return &SPSCRingBuf[T]{
+		a:    make([]T, n),
+		mask: uint64(n - 1),
+	}
+}
+
+// NewSPSCFrameRingBuf returns an SPSCFrameRingBuf holding at least maxSize frames.
+func NewSPSCFrameRingBuf(maxSize int) *SPSCFrameRingBuf {
+	return NewSPSCRingBuf[*tm.Frame](maxSize)
+}
+
+// Cap returns the number of elements the ring can hold.
+func (b *SPSCRingBuf[T]) Cap() int {
+	return len(b.a)
+}
+
+// Len returns the number of readable elements. With the other
+// side running concurrently it is a snapshot only.
+func (b *SPSCRingBuf[T]) Len() int {
+	return int(b.tail.Load() - b.head.Load())
+}
+
+// RingWriteFrames writes as much of p as fits, returning the
+// count written and io.ErrShortWrite if that is less than
+// len(p). Only the writing goroutine may call it.
+func (b *SPSCRingBuf[T]) RingWriteFrames(p []T) (n int, err error) {
+	tail := b.tail.Load()
+	free := uint64(len(b.a)) - (tail - b.head.Load())
+	n = len(p)
+	if uint64(n) > free {
+		n = int(free)
+		err = io.ErrShortWrite
+	}
+	for i := 0; i < n; i++ {
+		b.a[(tail+uint64(i))&b.mask] = p[i]
+	}
+	// publish: the reader sees the elements once it sees tail.
+	b.tail.Store(tail + uint64(n))
+	return n, err
+}
+
+// RingReadFrames reads up to len(p) elements into p, returning
+// the count read, or io.EOF if the ring is empty (unless len(p)
+// is zero). Only the reading goroutine may call it.
+func (b *SPSCRingBuf[T]) RingReadFrames(p []T) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	head := b.head.Load()
+	avail := b.tail.Load() - head
+	if avail == 0 {
+		return 0, io.EOF
+	}
+	n = len(p)
+	if uint64(n) > avail {
+		n = int(avail)
+	}
+	var zero T
+	for i := 0; i < n; i++ {
+		j := (head + uint64(i)) & b.mask
+		p[i] = b.a[j]
+		b.a[j] = zero // let the GC have it
+	}
+	// release the slots back to the writer.
+	b.head.Store(head + uint64(n))
+	return n, nil
+}
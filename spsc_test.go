@@ -0,0 +1,49 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tm "github.com/glycerine/tmframe"
+	"io"
+	"runtime"
+	"testing"
+)
+
+func Test044SPSCRingBufHandsOffInOrder(t *testing.T) {
+
+	cv.Convey("one writer and one reader spinning on an SPSCFrameRingBuf should pass every frame through in order; run under -race", t, func() {
+
+		n := 5000
+		frames, _, _ := GenTestFrames(n, nil)
+		ring := NewSPSCFrameRingBuf(6)
+		cv.So(ring.Cap(), cv.ShouldEqual, 8)
+
+		go func() {
+			p := frames
+			for len(p) > 0 {
+				k, _ := ring.RingWriteFrames(p[:intMin(len(p), 5)])
+				p = p[k:]
+				if k == 0 {
+					runtime.Gosched()
+				}
+			}
+		}()
+
+		got := make([]*tm.Frame, 0, n)
+		buf := make([]*tm.Frame, 3)
+		for len(got) < n {
+			k, err := ring.RingReadFrames(buf)
+			if err == io.EOF {
+				runtime.Gosched()
+				continue
+			}
+			got = append(got, buf[:k]...)
+		}
+		cv.So(got, cv.ShouldResemble, frames)
+		cv.So(ring.Len(), cv.ShouldEqual, 0)
+
+		full := NewSPSCFrameRingBuf(2)
+		k, err := full.RingWriteFrames(frames[:3])
+		cv.So(k, cv.ShouldEqual, 2)
+		cv.So(err, cv.ShouldEqual, io.ErrShortWrite)
+	})
+}
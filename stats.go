@@ -0,0 +1,87 @@
+package pq
+
+import (
+	"time"
+)
+
+// QueueStats tracks a PriorityQueue's traffic once EnableStats
+// has been called.
+type QueueStats struct {
+	Adds     int64 // entries added, via Add or heap.Push
+	Pops     int64 // entries removed by pops and Remove
+	Evicts   int64 // entries evicted by a bound or budget
+	Rejects  int64 // frames refused by Add, or stale updates
+	Depth    int64 // entries currently queued
+	MaxDepth int64 // the largest Depth seen
+
+	// MaxLag is the largest reordering lag seen: at each add,
+	// the latest timestamp added so far minus the head's
+	// timestamp. It bounds how far out of order input arrived
+	// relative to what was still waiting.
+	MaxLag time.Duration
+
+	latest time.Time
+}
+
+// Event describes one queue operation to an observer.
+type Event struct {
+	Op      JournalOp
+	FrameTm time.Time // the OrderBy of the frame concerned
+	Reason  string    // for rejects and evictions, why
+	Len     int       // queue length after the operation
+}
+
+// EnableStats turns on QueueStats, starting from the current
+// contents of the queue, and returns them. The counters are
+// updated in place, so the pointer may be kept.
+func (pq *PriorityQueue) EnableStats() *QueueStats {
+	if pq.Stats == nil {
+		pq.Stats = &QueueStats{
+			Depth:    int64(len(pq.Seq)),
+			MaxDepth: int64(len(pq.Seq)),
+		}
+	}
+	return pq.Stats
+}
+
+// SetObserver installs fn to be called after every add, pop,
+// update, reject, and eviction, for export to a metrics system.
+// fn runs synchronously inside the queue operation, so it must
+// be quick and must not call back into the queue. A nil fn
+// removes the observer.
+func (pq *PriorityQueue) SetObserver(fn func(Event)) {
+	pq.observer = fn
+}
+
+// record notes op in the Journal, the Stats, and the observer,
+// whichever are enabled.
+func (pq *PriorityQueue) record(op JournalOp, frameTm time.Time, reason string) {
+	pq.Journal.Record(op, frameTm, reason)
+	if s := pq.Stats; s != nil {
+		s.Depth = int64(len(pq.Seq))
+		if s.Depth > s.MaxDepth {
+			s.MaxDepth = s.Depth
+		}
+		switch op {
+		case JournalAdd:
+			s.Adds++
+			if frameTm.After(s.latest) {
+				s.latest = frameTm
+			}
+			if len(pq.Seq) > 0 {
+				if lag := s.latest.Sub(pq.Seq[0].OrderBy); lag > s.MaxLag {
+					s.MaxLag = lag
+				}
+			}
+		case JournalPop:
+			s.Pops++
+		case JournalEvict:
+			s.Evicts++
+		case JournalReject:
+			s.Rejects++
+		}
+	}
+	if pq.observer != nil {
+		pq.observer(Event{Op: op, FrameTm: frameTm, Reason: reason, Len: len(pq.Seq)})
+	}
+}
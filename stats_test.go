@@ -0,0 +1,73 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	"testing"
+)
+
+func Test046StatsAndObserver(t *testing.T) {
+
+	cv.Convey("QueueStats should count adds, pops, rejects, depth, and the largest reordering lag, and the observer should see each event", t, func() {
+
+		n := 10
+		frames, tms, _ := GenTestFrames(n, nil)
+		pq := NewBoundedPriorityQueue(6, RejectNewest)
+		st := pq.EnableStats()
+
+		var events []Event
+		pq.SetObserver(func(e Event) { events = append(events, e) })
+
+		// frame 5 arrives first, then 0..4, then 6..9 (four will be refused)
+		pq.Add(frames[5])
+		for i := 0; i < 5; i++ {
+			pq.Add(frames[i])
+		}
+		for i := 6; i < n; i++ {
+			pq.Add(frames[i])
+		}
+		cv.So(st.Adds, cv.ShouldEqual, int64(6))
+		cv.So(st.Rejects, cv.ShouldEqual, int64(4))
+		cv.So(st.Depth, cv.ShouldEqual, int64(6))
+		cv.So(st.MaxLag, cv.ShouldEqual, tms[5].Sub(tms[0]))
+
+		pq.PopN(4)
+		cv.So(st.Pops, cv.ShouldEqual, int64(4))
+		cv.So(st.Depth, cv.ShouldEqual, int64(2))
+		cv.So(st.MaxDepth, cv.ShouldEqual, int64(6))
+
+		cv.So(events, cv.ShouldHaveLength, 14)
+		cv.So(events[0].Op, cv.ShouldEqual, JournalAdd)
+		cv.So(events[0].FrameTm.Equal(tms[5]), cv.ShouldBeTrue)
+		cv.So(events[6].Op, cv.ShouldEqual, JournalReject)
+		cv.So(events[6].Reason, cv.ShouldEqual, ErrFull.Error())
+		cv.So(events[13].Op, cv.ShouldEqual, JournalPop)
+		cv.So(events[13].Len, cv.ShouldEqual, 2)
+
+		pq.SetObserver(nil)
+		pq.PopN(1)
+		cv.So(events, cv.ShouldHaveLength, 14)
+	})
+}
+
+func Test050EvictionsAreNotPops(t *testing.T) {
+
+	cv.Convey("an eviction should be journaled and observed once, as an evict, and counted apart from pops", t, func() {
+
+		frames, _, _ := GenTestFrames(3, nil)
+		pq := NewBoundedPriorityQueue(2, EvictEarliest)
+		st := pq.EnableStats()
+		var ops []JournalOp
+		pq.SetObserver(func(e Event) { ops = append(ops, e.Op) })
+
+		for _, f := range frames {
+			_, err := pq.Add(f)
+			cv.So(err, cv.ShouldBeNil)
+		}
+		cv.So(ops, cv.ShouldResemble, []JournalOp{JournalAdd, JournalAdd, JournalEvict, JournalAdd})
+		cv.So(st.Pops, cv.ShouldEqual, int64(0))
+		cv.So(st.Evicts, cv.ShouldEqual, int64(1))
+		cv.So(pq.Validate(), cv.ShouldBeNil)
+		f, _ := pq.PopFrame()
+		cv.So(f, cv.ShouldEqual, frames[1])
+	})
+}
@@ -0,0 +1,91 @@
+package pq
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Status is a point-in-time summary of a queue or ring for
+// operators, shaped for JSON.
+type Status struct {
+	Len       int         `json:"len"`
+	Cap       int         `json:"cap,omitempty"`       // 0 if unbounded
+	Occupancy float64     `json:"occupancy,omitempty"` // Len/Cap
+	Head      *time.Time  `json:"head,omitempty"`      // timestamp of the next frame out
+	Stats     *QueueStats `json:"stats,omitempty"`
+}
+
+// Status summarizes the queue: its length, bound and occupancy
+// if bounded, the OrderBy of its head, and its QueueStats if
+// enabled.
+func (pq *PriorityQueue) Status() Status {
+	s := Status{Len: pq.Len(), Cap: pq.MaxLen}
+	if s.Cap > 0 {
+		s.Occupancy = float64(s.Len) / float64(s.Cap)
+	}
+	if s.Len > 0 {
+		head := pq.First().OrderBy
+		s.Head = &head
+	}
+	if pq.Stats != nil {
+		st := *pq.Stats
+		s.Stats = &st
+	}
+	return s
+}
+
+// StatusJSON returns Status encoded as JSON.
+func (pq *PriorityQueue) StatusJSON() []byte {
+	return statusJSON(pq.Status())
+}
+
+// Status summarizes the ring: readable elements, size, and occupancy.
+func (b *RingBuf[T]) Status() Status {
+	s := Status{Len: b.Readable, Cap: b.N}
+	if b.N > 0 {
+		s.Occupancy = float64(b.Readable) / float64(b.N)
+	}
+	return s
+}
+
+// StatusJSON returns Status encoded as JSON.
+func (b *RingBuf[T]) StatusJSON() []byte {
+	return statusJSON(b.Status())
+}
+
+func statusJSON(s Status) []byte {
+	by, err := json.Marshal(s)
+	if err != nil {
+		// Status holds only plain values; this cannot happen.
+		panic(err)
+	}
+	return by
+}
+
+// statusVar adapts a StatusJSON method to expvar.Var.
+type statusVar struct {
+	mu     sync.Locker
+	status func() []byte
+}
+
+func (v statusVar) String() string {
+	if v.mu != nil {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+	}
+	return string(v.status())
+}
+
+// StatusVar adapts status, typically a queue's or ring's
+// StatusJSON method, to an expvar.Var for publishing on the
+// debug endpoint:
+//
+//	expvar.Publish("frameq", pq.StatusVar(&mu, q.StatusJSON))
+//
+// Neither queues nor rings lock themselves, so mu, if non-nil,
+// is held around each call; pass the lock that guards the queue.
+func StatusVar(mu sync.Locker, status func() []byte) expvar.Var {
+	return statusVar{mu: mu, status: status}
+}
@@ -0,0 +1,38 @@
+package pq
+
+import (
+	"encoding/json"
+	cv "github.com/glycerine/goconvey/convey"
+	"sync"
+	"testing"
+)
+
+func Test047StatusJSONAndExpvar(t *testing.T) {
+
+	cv.Convey("StatusJSON should report length, bound, occupancy, head and stats, and StatusVar should serve it to expvar", t, func() {
+
+		frames, tms, _ := GenTestFrames(8, nil)
+		pq := NewBoundedPriorityQueue(8, RejectNewest)
+		pq.EnableStats()
+		for _, f := range frames[2:6] {
+			pq.Add(f)
+		}
+
+		var got Status
+		cv.So(json.Unmarshal(pq.StatusJSON(), &got), cv.ShouldBeNil)
+		cv.So(got.Len, cv.ShouldEqual, 4)
+		cv.So(got.Cap, cv.ShouldEqual, 8)
+		cv.So(got.Occupancy, cv.ShouldEqual, 0.5)
+		cv.So(got.Head.Equal(tms[2]), cv.ShouldBeTrue)
+		cv.So(got.Stats.Adds, cv.ShouldEqual, int64(4))
+
+		empty := string(NewPriorityQueue().StatusJSON())
+		cv.So(empty, cv.ShouldEqual, `{"len":0}`)
+
+		ring := NewFrameRingBuf(4)
+		ring.RingWriteFrames(frames[:3])
+		var mu sync.Mutex
+		v := StatusVar(&mu, ring.StatusJSON)
+		cv.So(v.String(), cv.ShouldEqual, `{"len":3,"cap":4,"occupancy":0.75}`)
+	})
+}
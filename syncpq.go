@@ -0,0 +1,207 @@
+package pq
+
+import (
+	"context"
+	tf "github.com/glycerine/tmframe"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SyncPriorityQueue wraps a PriorityQueue with a mutex so that
+// producers and consumers on different goroutines can share it,
+// and lets consumers block in WaitPop instead of spinning.
+type SyncPriorityQueue struct {
+	mu   sync.Mutex
+	pq   *PriorityQueue
+	wake chan struct{} // closed, and replaced, whenever entries may have arrived
+	seq  uint32        // bumped with each close of wake; atomic
+	spin time.Duration // see SetSpin
+
+	// fairness between producers (Add) and consumers (PopFrame,
+	// WaitPop); see SetFairness.
+	maxRun  int
+	waiting [2]int32 // goroutines of each side waiting for mu; atomic
+	last    int      // side of the latest operation
+	run     int      // consecutive operations by that side
+	cstats  ContentionStats
+}
+
+// The two sides SetFairness balances.
+const (
+	producerSide = 0
+	consumerSide = 1
+)
+
+// ContentionStats shows how contended a SyncPriorityQueue's
+// lock is, and how evenly producers and consumers share it.
+type ContentionStats struct {
+	Acquires  int64         // lock acquisitions
+	Contended int64         // acquisitions that found the lock held
+	Wait      time.Duration // total time spent waiting for the lock
+	Yields    int64         // times a side stepped aside for the other
+	MaxRun    int           // longest run of operations by one side while the other waited
+}
+
+// NewSyncPriorityQueue returns a SyncPriorityQueue guarding pq,
+// or a fresh queue if pq is nil. Once wrapped, pq must only be
+// reached through the wrapper.
+func NewSyncPriorityQueue(pq *PriorityQueue) *SyncPriorityQueue {
+	if pq == nil {
+		pq = NewPriorityQueue()
+	}
+	return &SyncPriorityQueue{pq: pq, wake: make(chan struct{})}
+}
+
+// Add is PriorityQueue.Add under the lock; it wakes any
+// goroutines blocked in WaitPop.
+func (s *SyncPriorityQueue) Add(frame *tf.Frame) (*Pqe, error) {
+	s.lock(producerSide)
+	defer s.mu.Unlock()
+	pqe, err := s.pq.Add(frame)
+	if err == nil {
+		s.broadcast()
+	}
+	return pqe, err
+}
+
+// PopFrame is PriorityQueue.PopFrame under the lock.
+func (s *SyncPriorityQueue) PopFrame() (*tf.Frame, bool) {
+	s.lock(consumerSide)
+	defer s.mu.Unlock()
+	return s.pq.PopFrame()
+}
+
+// Len returns the number of queued entries.
+func (s *SyncPriorityQueue) Len() int {
+	s.lock(-1)
+	defer s.mu.Unlock()
+	return s.pq.Len()
+}
+
+// Do runs fn with the lock held, for any operation the wrapper
+// does not provide. fn must not keep pq past its return.
+// Waiters are woken afterwards, in case fn added entries.
+func (s *SyncPriorityQueue) Do(fn func(pq *PriorityQueue)) {
+	s.lock(-1)
+	defer s.mu.Unlock()
+	fn(s.pq)
+	s.broadcast()
+}
+
+// WaitPop removes and returns the earliest entry, blocking
+// until there is one or ctx is done, in which case it returns
+// ctx.Err(). See SetSpin for polling before blocking.
+func (s *SyncPriorityQueue) WaitPop(ctx context.Context) (*Pqe, error) {
+	spun := false
+	for {
+		s.lock(consumerSide)
+		if pqe, ok := s.pq.PopPqe(); ok {
+			s.mu.Unlock()
+			return pqe, nil
+		}
+		wake := s.wake
+		seen := atomic.LoadUint32(&s.seq)
+		spin := s.spin
+		s.mu.Unlock()
+
+		if spin > 0 && !spun {
+			spun = true
+			if spinUntil(spin, func() bool { return atomic.LoadUint32(&s.seq) != seen || ctx.Err() != nil }) {
+				continue
+			}
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// broadcast wakes every WaitPop. s.mu must be held.
+func (s *SyncPriorityQueue) broadcast() {
+	atomic.AddUint32(&s.seq, 1)
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
+
+// SetSpin has a WaitPop that finds the queue empty poll for up
+// to d, yielding the processor between polls, before it blocks
+// on the wake-up channel, as BlockingRingBuf.SetSpin does for
+// Reads. A d <= 0, the default, blocks at once.
+func (s *SyncPriorityQueue) SetSpin(d time.Duration) {
+	s.mu.Lock()
+	s.spin = d
+	s.mu.Unlock()
+}
+
+// SetFairness bounds how many operations in a row one side,
+// producers (Add) or consumers (PopFrame, WaitPop), may make
+// while the other side waits for the lock: after maxRun, the
+// side steps aside until the other has had a turn. This stops
+// a busy drain loop starving producers, or the reverse, at the
+// cost of some throughput. maxRun <= 0, the default, turns
+// fairness off. Len and Do belong to neither side.
+func (s *SyncPriorityQueue) SetFairness(maxRun int) {
+	s.mu.Lock()
+	s.maxRun = maxRun
+	s.mu.Unlock()
+}
+
+// Contention returns a snapshot of the lock's contention counters.
+func (s *SyncPriorityQueue) Contention() ContentionStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cstats
+}
+
+// lock acquires s.mu for an operation by side, which is
+// producerSide, consumerSide, or -1 for neither, counting
+// contention and, with fairness on, yielding to the other side
+// once this one has had maxRun operations in a row.
+func (s *SyncPriorityQueue) lock(side int) {
+	if side >= 0 {
+		atomic.AddInt32(&s.waiting[side], 1)
+	}
+	var waited time.Duration
+	contended := false
+	other := false // whether the other side was waiting
+	for {
+		if !s.mu.TryLock() {
+			contended = true
+			t0 := time.Now()
+			s.mu.Lock()
+			waited += time.Since(t0)
+		}
+		if side < 0 {
+			break
+		}
+		other = atomic.LoadInt32(&s.waiting[1-side]) > 0
+		if !other || s.maxRun <= 0 || s.last != side || s.run < s.maxRun {
+			break
+		}
+		s.cstats.Yields++
+		s.mu.Unlock()
+		runtime.Gosched()
+	}
+	s.cstats.Acquires++
+	s.cstats.Wait += waited
+	if contended {
+		s.cstats.Contended++
+	}
+	if side < 0 {
+		return
+	}
+	atomic.AddInt32(&s.waiting[side], -1)
+	if s.last == side {
+		s.run++
+	} else {
+		s.last = side
+		s.run = 1
+	}
+	if other && s.run > s.cstats.MaxRun {
+		s.cstats.MaxRun = s.run
+	}
+}
@@ -0,0 +1,125 @@
+package pq
+
+import (
+	"context"
+	cv "github.com/glycerine/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test048WaitPopBlocksUntilDataOrCancel(t *testing.T) {
+
+	cv.Convey("WaitPop consumers should receive every frame added by concurrent producers, and return when their context ends; run under -race", t, func() {
+
+		n := 400
+		frames, _, _ := GenTestFrames(n, nil)
+		q := NewSyncPriorityQueue(nil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var mu sync.Mutex
+		got := 0
+		var wg sync.WaitGroup
+		for c := 0; c < 3; c++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					_, err := q.WaitPop(ctx)
+					if err != nil {
+						return
+					}
+					mu.Lock()
+					got++
+					if got == n {
+						cancel()
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for p := 0; p < 4; p++ {
+			go func(p int) {
+				for i := p; i < n; i += 4 {
+					q.Add(frames[i])
+				}
+			}(p)
+		}
+		wg.Wait()
+		cv.So(got, cv.ShouldEqual, n)
+		cv.So(q.Len(), cv.ShouldEqual, 0)
+
+		short, done := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer done()
+		pqe, err := q.WaitPop(short)
+		cv.So(pqe, cv.ShouldBeNil)
+		cv.So(err, cv.ShouldEqual, context.DeadlineExceeded)
+	})
+}
+
+func Test059SyncPriorityQueueFairness(t *testing.T) {
+
+	cv.Convey("with SetFairness(k), neither producers nor consumers should make more than k operations in a row while the other side waits; run under -race", t, func() {
+
+		n := 2000
+		frames, _, _ := GenTestFrames(n, nil)
+		q := NewSyncPriorityQueue(nil)
+		q.SetFairness(4)
+
+		var wg sync.WaitGroup
+		for p := 0; p < 2; p++ {
+			wg.Add(1)
+			go func(p int) {
+				defer wg.Done()
+				for i := p; i < n; i += 2 {
+					q.Add(frames[i])
+				}
+			}(p)
+		}
+		popped := 0
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for popped < n {
+				if _, ok := q.PopFrame(); ok {
+					popped++
+				}
+			}
+		}()
+		wg.Wait()
+		<-done
+
+		st := q.Contention()
+		cv.So(popped, cv.ShouldEqual, n)
+		cv.So(st.MaxRun, cv.ShouldBeLessThanOrEqualTo, 4)
+		cv.So(st.Acquires, cv.ShouldBeGreaterThanOrEqualTo, 2*n)
+		cv.So(st.Contended, cv.ShouldBeLessThanOrEqualTo, st.Acquires)
+	})
+}
+
+func Test061WaitPopSpin(t *testing.T) {
+
+	cv.Convey("a WaitPop with SetSpin should take an entry added while it spins, and still return when its context ends mid-spin", t, func() {
+
+		frames, _, _ := GenTestFrames(1, nil)
+		q := NewSyncPriorityQueue(nil)
+		q.SetSpin(5 * time.Second)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			q.Add(frames[0])
+		}()
+		pqe, err := q.WaitPop(context.Background())
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(pqe.Val, cv.ShouldEqual, frames[0])
+
+		short, done := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer done()
+		t0 := time.Now()
+		pqe, err = q.WaitPop(short)
+		cv.So(pqe, cv.ShouldBeNil)
+		cv.So(err, cv.ShouldEqual, context.DeadlineExceeded)
+		cv.So(time.Since(t0), cv.ShouldBeLessThan, time.Second)
+	})
+}
@@ -0,0 +1,111 @@
+package pq
+
+import (
+	tf "github.com/glycerine/tmframe"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultMaxFrameBytes is the largest single marshalled frame
+// we expect to decode from a stream.
+const DefaultMaxFrameBytes = 1024 * 1024
+
+// TailSource follows a tmframe file that another process is
+// still appending to, like tail -f. At end of file it waits,
+// polling every Poll interval, rather than returning io.EOF.
+// A frame that has only been partially written is held back
+// until the rest of its bytes arrive.
+type TailSource struct {
+	Path string
+	Poll time.Duration
+
+	f    *os.File
+	fr   *tf.FrameReader
+	done chan struct{}
+	once sync.Once
+}
+
+// NewTailSource opens path for tailing. If poll is <= 0,
+// a 100 msec polling interval is used.
+func NewTailSource(path string, poll time.Duration) (*TailSource, error) {
+	if poll <= 0 {
+		poll = 100 * time.Millisecond
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &TailSource{
+		Path: path,
+		Poll: poll,
+		f:    f,
+		done: make(chan struct{}),
+	}
+	s.fr = tf.NewFrameReader(&tailReader{src: s}, DefaultMaxFrameBytes)
+	return s, nil
+}
+
+// NextFrame blocks until the next complete frame has been
+// written to the file, and returns it. After Close,
+// NextFrame returns io.EOF.
+func (s *TailSource) NextFrame() (*tf.Frame, error) {
+	var frame tf.Frame
+	_, _, err, _ := s.fr.NextFrame(&frame)
+	if err != nil {
+		if s.isClosed() {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	return &frame, nil
+}
+
+// Close stops the tail, releasing any goroutine blocked in NextFrame.
+func (s *TailSource) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		err = s.f.Close()
+	})
+	return err
+}
+
+func (s *TailSource) isClosed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// tailReader turns end-of-file into a wait, so that the
+// FrameReader above it only ever sees io.EOF after Close.
+type tailReader struct {
+	src *TailSource
+}
+
+func (r *tailReader) Read(p []byte) (int, error) {
+	for {
+		if r.src.isClosed() {
+			return 0, io.EOF
+		}
+		n, err := r.src.f.Read(p)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			if r.src.isClosed() {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		select {
+		case <-r.src.done:
+			return 0, io.EOF
+		case <-time.After(r.src.Poll):
+		}
+	}
+}
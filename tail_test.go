@@ -0,0 +1,62 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test004TailSourceFollowsAppends(t *testing.T) {
+
+	cv.Convey("a TailSource should decode frames as they are appended, and return io.EOF only after Close", t, func() {
+
+		dir, err := ioutil.TempDir("", "pq-tail")
+		panicOn(err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "live.tf")
+
+		frames, _, by := GenTestFrames(6, nil)
+		b0, err := frames[0].Marshal(nil)
+		panicOn(err)
+		first := len(b0)
+
+		f, err := os.Create(path)
+		panicOn(err)
+		defer f.Close()
+		_, err = f.Write(by[:first])
+		panicOn(err)
+
+		src, err := NewTailSource(path, time.Millisecond)
+		panicOn(err)
+
+		got, err := src.NextFrame()
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(got.Tm(), cv.ShouldEqual, frames[0].Tm())
+
+		// the writer dribbles the rest in, splitting a frame across writes.
+		go func() {
+			rest := by[first:]
+			half := len(rest) / 2
+			f.Write(rest[:half])
+			time.Sleep(10 * time.Millisecond)
+			f.Write(rest[half:])
+		}()
+
+		for i := 1; i < len(frames); i++ {
+			got, err = src.NextFrame()
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(got.Tm(), cv.ShouldEqual, frames[i].Tm())
+		}
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			src.Close()
+		}()
+		_, err = src.NextFrame()
+		cv.So(err, cv.ShouldEqual, io.EOF)
+	})
+}
@@ -5,35 +5,118 @@ import (
 	"io"
 )
 
-// FrameRingBuf:
+// RingBuf:
 //
-//  a fixed-size circular ring buffer of *tm.Frame
+//  a fixed-size circular ring buffer of T
 //
-type FrameRingBuf struct {
-	A        []*tm.Frame
+type RingBuf[T any] struct {
+	A        []T
 	N        int // MaxView, the total size of A, whether or not in use.
 	Beg      int // start of in-use data in A
-	Readable int // number of pointers available in A (in use)
+	Readable int // number of elements available in A (in use)
+
+	// SizeFunc, if non-nil, measures element payloads for MemUsage.
+	SizeFunc func(T) int64
+
+	// AutoGrow makes RingWriteFrames Grow the ring, at least
+	// doubling it, rather than return io.ErrShortWrite.
+	// WriteOverwrite ignores it: it keeps the last N by design.
+	AutoGrow bool
+
+	// Protected, if non-nil, marks elements that WriteOverwrite
+	// should keep: when the ring is full it drops the oldest
+	// unprotected element instead of the oldest. See
+	// ProtectEvtnums.
+	Protected func(T) bool
+
+	// adoptDone, when set, is the callback owed to whoever
+	// handed us A via AdoptExclusive.
+	adoptDone func([]T)
 }
 
-// NewFrameRingBuf returns a new FrameRingBuf; it
+// FrameRingBuf is the ring buffer of *tm.Frame that this
+// package started with; it is kept as an alias so existing
+// callers continue to compile.
+type FrameRingBuf = RingBuf[*tm.Frame]
+
+// NewRingBuf returns a new RingBuf; it
 // will allocate internally a slice of size maxSize
-func NewFrameRingBuf(maxSize int) *FrameRingBuf {
+func NewRingBuf[T any](maxSize int) *RingBuf[T] {
 	n := maxSize
-	r := &FrameRingBuf{
+	r := &RingBuf[T]{
 		N:        n,
 		Beg:      0,
 		Readable: 0,
 	}
-	r.A = make([]*tm.Frame, n, n)
+	r.A = make([]T, n, n)
+
+	return r
+}
+
+// NewFrameRingBuf returns a new FrameRingBuf; it
+// will allocate internally a slice of size maxSize
+func NewFrameRingBuf(maxSize int) *FrameRingBuf {
+	return NewRingBuf[*tm.Frame](maxSize)
+}
 
+// NewGrowableRingBuf returns a RingBuf of initial size
+// maxSize with AutoGrow set.
+func NewGrowableRingBuf[T any](maxSize int) *RingBuf[T] {
+	r := NewRingBuf[T](maxSize)
+	r.AutoGrow = true
 	return r
 }
 
-// TwoContig returns all readable pointers, but in two separate slices,
+// NewGrowableFrameRingBuf returns a FrameRingBuf of initial
+// size maxSize with AutoGrow set.
+func NewGrowableFrameRingBuf(maxSize int) *FrameRingBuf {
+	return NewGrowableRingBuf[*tm.Frame](maxSize)
+}
+
+// Grow reallocates the ring to hold newSize elements, keeping
+// the readable elements in order, unwrapped to the start of
+// the new buffer. It does nothing if newSize is not larger
+// than N. An exclusively adopted buffer is handed back.
+func (b *RingBuf[T]) Grow(newSize int) {
+	if newSize <= b.N {
+		return
+	}
+	a := make([]T, newSize, newSize)
+	first, second := b.TwoContig(false)
+	n := copy(a, first)
+	copy(a[n:], second)
+	b.release()
+	b.A = a
+	b.N = newSize
+	b.Beg = 0
+}
+
+// Shrink reallocates the ring down to just the readable
+// elements, unwrapped to the start of the new buffer, so a
+// long-lived ring can give back memory after a burst. An empty
+// ring keeps room for one element, since a zero-size ring can
+// never be written again. Combine with AutoGrow to let the ring
+// grow back on demand. An exclusively adopted buffer is handed
+// back.
+func (b *RingBuf[T]) Shrink() {
+	size := intMax(b.Readable, 1)
+	if size >= b.N {
+		return
+	}
+	a := make([]T, size, size)
+	first, second := b.TwoContig(false)
+	n := copy(a, first)
+	copy(a[n:], second)
+	b.release()
+	b.A = a
+	b.N = size
+	b.Beg = 0
+}
+
+// TwoContig returns all readable elements, but in two separate slices,
 // to avoid copying. The two slices are from the same buffer, but
 // are not contiguous. Either or both may be empty slices.
-func (b *FrameRingBuf) TwoContig(makeCopy bool) (first []*tm.Frame, second []*tm.Frame) {
+func (b *RingBuf[T]) TwoContig(makeCopy bool) (first []T, second []T) {
 
 	extent := b.Beg + b.Readable
 	if extent <= b.N {
@@ -45,22 +128,22 @@ func (b *FrameRingBuf) TwoContig(makeCopy bool) (first []*tm.Frame, second []*tm
 	return b.A[b.Beg:b.N], b.A[0:(extent % b.N)]
 }
 
-// RingReadFrames reads the next len(p) *tm.Frame
-// pointers from the internal ring into p, or until the ring
-// is drained. The return value n is the number of pointers
+// RingReadFrames reads the next len(p) elements
+// from the internal ring into p, or until the ring
+// is drained. The return value n is the number of elements
 // read. If the buffer has no data to return, err is io.EOF
 // (unless len(p) is zero); otherwise it is nil.
-func (b *FrameRingBuf) RingReadFrames(p []*tm.Frame) (n int, err error) {
+func (b *RingBuf[T]) RingReadFrames(p []T) (n int, err error) {
 	return b.readAndMaybeAdvance(p, true)
 }
 
 // ReadWithoutAdvance(): if you want to Read the data and leave
 // it in the buffer, so as to peek ahead for example.
-func (b *FrameRingBuf) RingReadWithoutAdvance(p []*tm.Frame) (n int, err error) {
+func (b *RingBuf[T]) RingReadWithoutAdvance(p []T) (n int, err error) {
 	return b.readAndMaybeAdvance(p, false)
 }
 
-func (b *FrameRingBuf) readAndMaybeAdvance(p []*tm.Frame, doAdvance bool) (n int, err error) {
+func (b *RingBuf[T]) readAndMaybeAdvance(p []T, doAdvance bool) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
@@ -83,13 +166,17 @@ func (b *FrameRingBuf) readAndMaybeAdvance(p []*tm.Frame, doAdvance bool) (n int
 }
 
 //
-// RingWriteFrames writes len(p) *tm.Frame values from p to
+// RingWriteFrames writes len(p) elements from p to
 // the underlying data stream.
 // It returns the number of bytes written from p (0 <= n <= len(p))
 // and any error encountered that caused the write to stop early.
 // RingWriteFrames must return a non-nil error if it returns n < len(p).
+// With AutoGrow set, the ring grows to fit p instead.
 //
-func (b *FrameRingBuf) RingWriteFrames(p []*tm.Frame) (n int, err error) {
+func (b *RingBuf[T]) RingWriteFrames(p []T) (n int, err error) {
+	if b.AutoGrow && len(p) > b.N-b.Readable {
+		b.Grow(intMax(2*b.N, b.Readable+len(p)))
+	}
 	for {
 		if len(p) == 0 {
 			// nothing (left) to copy in; notice we shorten our
@@ -123,10 +210,129 @@ func (b *FrameRingBuf) RingWriteFrames(p []*tm.Frame) (n int, err error) {
 	}
 }
 
+// WriteOverwrite writes all of p into the ring. Where the ring
+// lacks room, the oldest readable elements are silently dropped
+// to make space, so the ring always ends up holding the most
+// recent min(N, Readable+len(p)) elements, as a "keep the last N"
+// capture buffer wants. It returns the number of elements of p
+// written and the number of older elements overwritten (elements
+// of p itself that could never fit count as overwritten too).
+//
+// With Protected set, the element dropped is instead the oldest
+// unprotected one, which may be an incoming element of p. Only
+// when every element, incoming included, is protected does the
+// oldest give way regardless. Each such drop scans past the
+// protected elements at the old end and shifts them up by one.
+func (b *RingBuf[T]) WriteOverwrite(p []T) (n int, overwritten int) {
+	if b.N == 0 {
+		return 0, len(p)
+	}
+	if b.Protected != nil {
+		return b.writeProtected(p)
+	}
+	if len(p) >= b.N {
+		overwritten = b.Readable + len(p) - b.N
+		copy(b.A, p[len(p)-b.N:])
+		b.Beg = 0
+		b.Readable = b.N
+		return len(p), overwritten
+	}
+	if excess := b.Readable + len(p) - b.N; excess > 0 {
+		b.Advance(excess)
+		overwritten = excess
+	}
+	n, _ = b.RingWriteFrames(p)
+	return n, overwritten
+}
+
+// writeProtected is WriteOverwrite with b.Protected set.
+func (b *RingBuf[T]) writeProtected(p []T) (n int, overwritten int) {
+	for _, x := range p {
+		if b.Readable == b.N {
+			overwritten++
+			i := 0
+			for i < b.Readable && b.Protected(b.A[(b.Beg+i)%b.N]) {
+				i++
+			}
+			switch {
+			case i < b.Readable:
+				b.removeAt(i)
+			case !b.Protected(x):
+				continue
+			default:
+				b.Advance(1)
+			}
+		}
+		b.A[(b.Beg+b.Readable)%b.N] = x
+		b.Readable++
+	}
+	return len(p), overwritten
+}
+
+// removeAt drops the i-th readable element, moving the older
+// ones up a slot to close the gap.
+func (b *RingBuf[T]) removeAt(i int) {
+	for j := i; j > 0; j-- {
+		b.A[(b.Beg+j)%b.N] = b.A[(b.Beg+j-1)%b.N]
+	}
+	b.Advance(1)
+}
+
+// ProtectEvtnums returns a Protected predicate for a
+// FrameRingBuf that keeps frames of the given Evtnums, such as
+// session state, through WriteOverwrite, so a flight recorder
+// retains the context needed to interpret its data frames.
+func ProtectEvtnums(evs ...tm.Evtnum) func(*tm.Frame) bool {
+	set := make(map[tm.Evtnum]bool, len(evs))
+	for _, ev := range evs {
+		set[ev] = true
+	}
+	return func(f *tm.Frame) bool {
+		return f != nil && set[f.GetEvtnum()]
+	}
+}
+
+// FilteredView returns, oldest first, a newly allocated slice of
+// the readable elements for which pred returns true. The ring
+// is not modified.
+func (b *RingBuf[T]) FilteredView(pred func(T) bool) []T {
+	var res []T
+	first, second := b.TwoContig(false)
+	for _, f := range first {
+		if pred(f) {
+			res = append(res, f)
+		}
+	}
+	for _, f := range second {
+		if pred(f) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// CountWhere returns the number of readable elements for which
+// pred returns true, without allocating.
+func (b *RingBuf[T]) CountWhere(pred func(T) bool) int {
+	n := 0
+	first, second := b.TwoContig(false)
+	for _, f := range first {
+		if pred(f) {
+			n++
+		}
+	}
+	for _, f := range second {
+		if pred(f) {
+			n++
+		}
+	}
+	return n
+}
+
 // Reset quickly forgets any data stored in the ring buffer. The
 // data is still there, but the ring buffer will ignore it and
 // overwrite those buffers as new data comes in.
-func (b *FrameRingBuf) Reset() {
+func (b *RingBuf[T]) Reset() {
 	b.Beg = 0
 	b.Readable = 0
 }
@@ -135,7 +341,7 @@ func (b *FrameRingBuf) Reset() {
 // because we don't have to unwrap our buffer and pay the cpu time
 // for the copy that unwrapping may need.
 // Useful in conjuction/after ReadWithoutAdvance() above.
-func (b *FrameRingBuf) Advance(n int) {
+func (b *RingBuf[T]) Advance(n int) {
 	if n <= 0 {
 		return
 	}
@@ -146,6 +352,26 @@ func (b *FrameRingBuf) Advance(n int) {
 	b.Beg = (b.Beg + n) % b.N
 }
 
+// Nth returns the i-th readable element, counting from the
+// oldest at 0, without copying or advancing. ok is false if i
+// is out of range.
+func (b *RingBuf[T]) Nth(i int) (x T, ok bool) {
+	if i < 0 || i >= b.Readable {
+		return x, false
+	}
+	return b.A[(b.Beg+i)%b.N], true
+}
+
+// Peek returns the oldest readable element, the next to be read.
+func (b *RingBuf[T]) Peek() (x T, ok bool) {
+	return b.Nth(0)
+}
+
+// Last returns the newest readable element, the last written.
+func (b *RingBuf[T]) Last() (x T, ok bool) {
+	return b.Nth(b.Readable - 1)
+}
+
 // Adopt: for efficiency's sake, (possibly) take ownership of
 // already allocated slice offered in me.
 //
@@ -153,9 +379,16 @@ func (b *FrameRingBuf) Advance(n int) {
 // write to the me buffer.
 // If we already have a bigger buffer, copy me into the existing
 // buffer instead.
-func (b *FrameRingBuf) Adopt(me []*tm.Frame) {
+//
+// Because the caller cannot tell which of these happened
+// without comparing len(me) to b.N, it must treat me as
+// handed over and never touch it again. Use AdoptCopy to
+// keep ownership of me, or AdoptExclusive to be told when
+// the ring is finished with it.
+func (b *RingBuf[T]) Adopt(me []T) {
 	n := len(me)
 	if n > b.N {
+		b.release()
 		b.A = me
 		b.N = n
 		b.Beg = 0
@@ -168,6 +401,68 @@ func (b *FrameRingBuf) Adopt(me []*tm.Frame) {
 	}
 }
 
+// AdoptCopy loads the contents of me into the ring, always
+// copying, so the caller keeps sole ownership of me. The ring's
+// buffer is reallocated if me does not fit.
+func (b *RingBuf[T]) AdoptCopy(me []T) {
+	n := len(me)
+	if n > b.N {
+		b.release()
+		b.A = make([]T, n, n)
+		b.N = n
+	}
+	copy(b.A, me)
+	b.Beg = 0
+	b.Readable = n
+}
+
+// AdoptExclusive takes ownership of me without copying; its
+// contents become the readable data of the ring. The caller must
+// not read or write me until the ring hands it back by calling
+// done(me), which happens when a later Adopt, AdoptCopy,
+// AdoptExclusive, or Release replaces the buffer. This lets
+// pooled producers recycle buffers safely. done may be nil.
+func (b *RingBuf[T]) AdoptExclusive(me []T, done func([]T)) {
+	if len(me) == 0 {
+		// a zero-size ring cannot be indexed; hand it straight
+		// back, and give up any buffer we had been lent, as
+		// Release does, rather than keep writing into it.
+		if done != nil {
+			done(me)
+		}
+		b.Release()
+		return
+	}
+	b.release()
+	b.A = me
+	b.N = len(me)
+	b.Beg = 0
+	b.Readable = len(me)
+	b.adoptDone = done
+}
+
+// Release hands an exclusively adopted buffer back to its
+// owner, replacing it with a freshly allocated one of the same
+// size, and empties the ring.
+func (b *RingBuf[T]) Release() {
+	if b.adoptDone != nil {
+		b.release()
+		b.A = make([]T, b.N, b.N)
+	}
+	b.Reset()
+}
+
+// release invokes the pending AdoptExclusive callback, if any.
+// The caller is about to stop using b.A.
+func (b *RingBuf[T]) release() {
+	if b.adoptDone == nil {
+		return
+	}
+	done := b.adoptDone
+	b.adoptDone = nil
+	done(b.A)
+}
+
 /*
 func intMax(a, b int) int {
 	if a > b {
@@ -0,0 +1,284 @@
+package pq
+
+import (
+	cv "github.com/glycerine/goconvey/convey"
+	tm "github.com/glycerine/tmframe"
+	"io"
+	"sync"
+	"testing"
+)
+
+func Test008AdoptExclusiveHandsBuffersBack(t *testing.T) {
+
+	cv.Convey("pooled producers handing buffers to a FrameRingBuf via AdoptExclusive should only reuse them after done; run under -race", t, func() {
+
+		frames, _, _ := GenTestFrames(8, nil)
+
+		// a pool of buffers; a buffer is either in the pool,
+		// owned by a producer, in flight, or owned by the ring.
+		pool := make(chan []*tm.Frame, 3)
+		for i := 0; i < cap(pool); i++ {
+			pool <- make([]*tm.Frame, len(frames))
+		}
+		handoff := make(chan []*tm.Frame)
+		giveBack := func(buf []*tm.Frame) { pool <- buf }
+
+		producers := 4
+		rounds := 50
+		var wg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for r := 0; r < rounds; r++ {
+					buf := <-pool
+					copy(buf, frames)
+					handoff <- buf
+				}
+			}()
+		}
+		go func() {
+			wg.Wait()
+			close(handoff)
+		}()
+
+		ring := NewFrameRingBuf(len(frames))
+		got := make([]*tm.Frame, len(frames))
+		batches := 0
+		for buf := range handoff {
+			ring.AdoptExclusive(buf, giveBack)
+			n, err := ring.RingReadFrames(got)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(n, cv.ShouldEqual, len(frames))
+			batches++
+		}
+		ring.Release()
+		cv.So(batches, cv.ShouldEqual, producers*rounds)
+		cv.So(len(pool), cv.ShouldEqual, cap(pool))
+	})
+
+	cv.Convey("AdoptCopy should leave the caller's slice untouched by later ring writes", t, func() {
+
+		frames, _, _ := GenTestFrames(4, nil)
+		mine := []*tm.Frame{frames[0], frames[1]}
+		ring := NewFrameRingBuf(2)
+		ring.AdoptCopy(mine)
+		ring.Advance(2)
+		ring.RingWriteFrames(frames[2:4])
+		cv.So(mine[0], cv.ShouldEqual, frames[0])
+		cv.So(mine[1], cv.ShouldEqual, frames[1])
+	})
+
+	cv.Convey("AdoptExclusive of an empty slice should hand back the lent buffer and stop writing into it", t, func() {
+
+		frames, _, _ := GenTestFrames(4, nil)
+		buf1 := make([]*tm.Frame, 2)
+		var back [][]*tm.Frame
+		ring := NewFrameRingBuf(2)
+		ring.AdoptExclusive(buf1, func(b []*tm.Frame) { back = append(back, b) })
+		ring.AdoptExclusive(nil, nil)
+		cv.So(back, cv.ShouldHaveLength, 1)
+		cv.So(ring.Readable, cv.ShouldEqual, 0)
+
+		n, err := ring.RingWriteFrames(frames[:2])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(n, cv.ShouldEqual, 2)
+		cv.So(buf1[0], cv.ShouldBeNil)
+		cv.So(buf1[1], cv.ShouldBeNil)
+	})
+}
+
+func Test009FilteredViewAcrossTheWrap(t *testing.T) {
+
+	cv.Convey("FilteredView and CountWhere should see readable frames in order, across the wrap point", t, func() {
+
+		frames, _, _ := GenTestFrames(9, nil)
+		ring := NewFrameRingBuf(6)
+		ring.RingWriteFrames(frames[:6])
+		ring.Advance(4)
+		ring.RingWriteFrames(frames[6:9])
+		// readable now: frames[4..8], wrapped.
+
+		isZero := func(f *tm.Frame) bool { return f.GetEvtnum() == tm.EvZero }
+		view := ring.FilteredView(isZero)
+		cv.So(len(view), cv.ShouldEqual, 2)
+		cv.So(view[0], cv.ShouldEqual, frames[4])
+		cv.So(view[1], cv.ShouldEqual, frames[7])
+		cv.So(ring.CountWhere(isZero), cv.ShouldEqual, 2)
+		cv.So(ring.Readable, cv.ShouldEqual, 5)
+	})
+}
+
+func Test020GenericRingBufHoldsAnyType(t *testing.T) {
+
+	cv.Convey("RingBuf[T] should run the same ring logic for non-frame element types", t, func() {
+
+		ring := NewRingBuf[int](4)
+		n, err := ring.RingWriteFrames([]int{1, 2, 3, 4, 5})
+		cv.So(n, cv.ShouldEqual, 4)
+		cv.So(err, cv.ShouldNotBeNil)
+		ring.Advance(2)
+		ring.RingWriteFrames([]int{5, 6})
+
+		got := make([]int, 4)
+		n, err = ring.RingReadFrames(got)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(got[:n], cv.ShouldResemble, []int{3, 4, 5, 6})
+
+		var fr *FrameRingBuf = NewFrameRingBuf(2)
+		cv.So(fr.N, cv.ShouldEqual, 2)
+	})
+}
+
+func Test022WriteOverwriteKeepsTheLastN(t *testing.T) {
+
+	cv.Convey("WriteOverwrite should drop the oldest frames rather than fail when the ring is full", t, func() {
+
+		frames, _, _ := GenTestFrames(12, nil)
+		ring := NewFrameRingBuf(5)
+
+		n, over := ring.WriteOverwrite(frames[:3])
+		cv.So(n, cv.ShouldEqual, 3)
+		cv.So(over, cv.ShouldEqual, 0)
+
+		n, over = ring.WriteOverwrite(frames[3:7])
+		cv.So(n, cv.ShouldEqual, 4)
+		cv.So(over, cv.ShouldEqual, 2)
+
+		got := make([]*tm.Frame, 5)
+		k, _ := ring.RingReadWithoutAdvance(got)
+		cv.So(got[:k], cv.ShouldResemble, frames[2:7])
+
+		// a write larger than the ring keeps only its own tail.
+		n, over = ring.WriteOverwrite(frames[:12])
+		cv.So(n, cv.ShouldEqual, 12)
+		cv.So(over, cv.ShouldEqual, 12)
+		k, _ = ring.RingReadFrames(got)
+		cv.So(got[:k], cv.ShouldResemble, frames[7:12])
+	})
+
+	cv.Convey("with protected Evtnums, WriteOverwrite should drop the oldest unprotected frame instead", t, func() {
+
+		frames, _, _ := GenTestFrames(11, nil)
+		ring := NewFrameRingBuf(4)
+		ring.Protected = ProtectEvtnums(tm.EvMsgpKafka) // frames 0, 3, 6, 9
+		view := func() []*tm.Frame { return ring.FilteredView(func(*tm.Frame) bool { return true }) }
+
+		n, over := ring.WriteOverwrite(frames[:6])
+		cv.So(n, cv.ShouldEqual, 6)
+		cv.So(over, cv.ShouldEqual, 2)
+		cv.So(view(), cv.ShouldResemble, []*tm.Frame{frames[0], frames[3], frames[4], frames[5]})
+
+		_, over = ring.WriteOverwrite(frames[6:10])
+		cv.So(over, cv.ShouldEqual, 4)
+		cv.So(view(), cv.ShouldResemble, []*tm.Frame{frames[0], frames[3], frames[6], frames[9]})
+
+		// with nothing unprotected queued, an unprotected frame is
+		// itself the one dropped...
+		_, over = ring.WriteOverwrite(frames[10:11])
+		cv.So(over, cv.ShouldEqual, 1)
+		cv.So(view(), cv.ShouldResemble, []*tm.Frame{frames[0], frames[3], frames[6], frames[9]})
+
+		// ...and a protected one displaces the oldest.
+		_, over = ring.WriteOverwrite(frames[0:1])
+		cv.So(over, cv.ShouldEqual, 1)
+		cv.So(view(), cv.ShouldResemble, []*tm.Frame{frames[3], frames[6], frames[9], frames[0]})
+	})
+}
+
+func Test041PeekLastNthIndexFromBeg(t *testing.T) {
+
+	cv.Convey("Peek, Last and Nth should address readable frames logically, across the wrap, without consuming them", t, func() {
+
+		frames, _, _ := GenTestFrames(8, nil)
+		ring := NewFrameRingBuf(5)
+		_, ok := ring.Peek()
+		cv.So(ok, cv.ShouldBeFalse)
+		_, ok = ring.Last()
+		cv.So(ok, cv.ShouldBeFalse)
+
+		ring.RingWriteFrames(frames[:4])
+		ring.Advance(3)
+		ring.RingWriteFrames(frames[4:7]) // wraps
+		cv.So(ring.Readable, cv.ShouldEqual, 4)
+
+		f, ok := ring.Peek()
+		cv.So(ok, cv.ShouldBeTrue)
+		cv.So(f, cv.ShouldEqual, frames[3])
+		f, _ = ring.Last()
+		cv.So(f, cv.ShouldEqual, frames[6])
+		for i := 0; i < 4; i++ {
+			f, ok = ring.Nth(i)
+			cv.So(ok, cv.ShouldBeTrue)
+			cv.So(f, cv.ShouldEqual, frames[3+i])
+		}
+		_, ok = ring.Nth(4)
+		cv.So(ok, cv.ShouldBeFalse)
+		_, ok = ring.Nth(-1)
+		cv.So(ok, cv.ShouldBeFalse)
+		cv.So(ring.Readable, cv.ShouldEqual, 4)
+	})
+}
+
+func Test042GrowKeepsContentsInOrder(t *testing.T) {
+
+	cv.Convey("Grow should keep wrapped contents in order, and an AutoGrow ring should never short-write", t, func() {
+
+		frames, _, _ := GenTestFrames(40, nil)
+		ring := NewFrameRingBuf(4)
+		ring.RingWriteFrames(frames[:3])
+		ring.Advance(2)
+		ring.RingWriteFrames(frames[3:6]) // wraps; ring now full
+		_, err := ring.RingWriteFrames(frames[6:7])
+		cv.So(err, cv.ShouldEqual, io.ErrShortWrite)
+
+		ring.Grow(8)
+		cv.So(ring.N, cv.ShouldEqual, 8)
+		cv.So(ring.FilteredView(func(*tm.Frame) bool { return true }), cv.ShouldResemble, frames[2:6])
+		n, err := ring.RingWriteFrames(frames[6:10])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(n, cv.ShouldEqual, 4)
+		ring.Grow(2)
+		cv.So(ring.N, cv.ShouldEqual, 8)
+
+		g := NewGrowableFrameRingBuf(2)
+		for i := 0; i < 40; i += 3 {
+			end := i + 3
+			if end > 40 {
+				end = 40
+			}
+			_, err := g.RingWriteFrames(frames[i:end])
+			cv.So(err, cv.ShouldBeNil)
+			if i%2 == 0 {
+				g.Advance(1)
+			}
+		}
+		got := g.FilteredView(func(*tm.Frame) bool { return true })
+		cv.So(got, cv.ShouldResemble, frames[40-len(got):])
+		cv.So(g.N >= g.Readable, cv.ShouldBeTrue)
+	})
+}
+
+func Test043ShrinkReleasesTheBurst(t *testing.T) {
+
+	cv.Convey("Shrink should cut the ring down to its readable frames, in order, and an AutoGrow ring should grow back", t, func() {
+
+		frames, _, _ := GenTestFrames(30, nil)
+		ring := NewGrowableFrameRingBuf(4)
+		ring.RingWriteFrames(frames) // the burst
+		cv.So(ring.N >= 30, cv.ShouldBeTrue)
+		ring.Advance(27)
+
+		ring.Shrink()
+		cv.So(ring.N, cv.ShouldEqual, 3)
+		cv.So(ring.Beg, cv.ShouldEqual, 0)
+		cv.So(ring.FilteredView(func(*tm.Frame) bool { return true }), cv.ShouldResemble, frames[27:])
+
+		ring.Advance(3)
+		ring.Shrink()
+		cv.So(ring.N, cv.ShouldEqual, 1)
+		_, err := ring.RingWriteFrames(frames[:5])
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(ring.Readable, cv.ShouldEqual, 5)
+	})
+}
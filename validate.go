@@ -0,0 +1,49 @@
+package pq
+
+import (
+	"fmt"
+)
+
+// Validate walks Seq and checks the invariants the heap
+// relies on: no nil entries or frames, every entry's Idx equal
+// to its position, no entry ordered before its parent, and a
+// time index, if enabled, holding exactly the queued entries.
+// It returns an error describing the first violation found, or
+// nil. Validate is O(n) and meant for tests and for checking
+// a queue after editing Seq by hand and calling Reinit.
+func (pq *PriorityQueue) Validate() error {
+	for i, pqe := range pq.Seq {
+		if pqe == nil {
+			return fmt.Errorf("pq: Seq[%d] is nil", i)
+		}
+		if pqe.Val == nil {
+			return fmt.Errorf("pq: Seq[%d] has a nil frame", i)
+		}
+		if pqe.Idx != i {
+			return fmt.Errorf("pq: Seq[%d] has Idx %d", i, pqe.Idx)
+		}
+		if i == 0 {
+			continue
+		}
+		parent := (i - 1) / 2
+		if pq.Less(i, parent) {
+			return fmt.Errorf("pq: heap order violated: Seq[%d] (%v) sorts before its parent Seq[%d] (%v)",
+				i, pqe.OrderBy, parent, pq.Seq[parent].OrderBy)
+		}
+	}
+	if pq.byTime == nil {
+		return nil
+	}
+	if len(pq.byTime) != len(pq.Seq) {
+		return fmt.Errorf("pq: time index holds %d entries, Seq %d", len(pq.byTime), len(pq.Seq))
+	}
+	for i, pqe := range pq.byTime {
+		if pqe.Idx < 0 || pqe.Idx >= len(pq.Seq) || pq.Seq[pqe.Idx] != pqe {
+			return fmt.Errorf("pq: time index entry %d is not queued", i)
+		}
+		if i > 0 && !earlier(pq.byTime[i-1], pqe) {
+			return fmt.Errorf("pq: time index out of order at %d", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package pq
+
+import (
+	"fmt"
+	tf "github.com/glycerine/tmframe"
+	"time"
+)
+
+// OrderError reports a FrameSource that yielded a frame
+// earlier than the one before it.
+type OrderError struct {
+	Pos   int64     // 0-based position of the offending frame in the source
+	Prev  *tf.Frame // the frame before it
+	Frame *tf.Frame // the offending frame
+}
+
+func (e *OrderError) Error() string {
+	return fmt.Sprintf("pq: source out of order at frame %d: %v is before the previous frame's %v",
+		e.Pos, time.Unix(0, e.Frame.Tm()).UTC(), time.Unix(0, e.Prev.Tm()).UTC())
+}
+
+// verifiedSource passes frames through while checking their order.
+type verifiedSource struct {
+	src  FrameSource
+	prev *tf.Frame
+	pos  int64
+	err  error
+}
+
+// NewVerifiedSource wraps s, asserting that it yields
+// non-decreasing timestamps. At the first violation NextFrame
+// returns an *OrderError naming the offending frame and its
+// position, and keeps returning it thereafter. The Merger
+// assumes sorted inputs; wrap any input you do not trust.
+func NewVerifiedSource(s FrameSource) FrameSource {
+	return &verifiedSource{src: s}
+}
+
+func (v *verifiedSource) NextFrame() (*tf.Frame, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	f, err := v.src.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	if v.prev != nil && f.Tm() < v.prev.Tm() {
+		v.err = &OrderError{Pos: v.pos, Prev: v.prev, Frame: f}
+		return nil, v.err
+	}
+	v.prev = f
+	v.pos++
+	return f, nil
+}